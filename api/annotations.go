@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/store"
+)
+
+func (s *Server) getBookmark(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.respondBookmark(c, archive, c.GetString(userIDKey), c.Param("tweet"))
+	}
+}
+
+// annotateBookmark updates the note and highlights of a bookmark, fields missing from the body are kept
+func (s *Server) annotateBookmark(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Note       *string             `json:"note"`
+			Highlights *[]models.Highlight `json:"highlights"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body, expected {\"note\": \"...\", \"highlights\": [...]}"})
+			return
+		}
+
+		userID, tweetID := c.GetString(userIDKey), c.Param("tweet")
+		bookmark, err := archive.GetBookmark(c.Request.Context(), userID, tweetID)
+		if err != nil {
+			respondArchiveError(c, err, "Failed to fetch bookmark")
+			return
+		}
+
+		note, highlights := bookmark.Note, bookmark.Highlights
+		if body.Note != nil {
+			note = *body.Note
+		}
+		if body.Highlights != nil {
+			highlights, err = store.NormalizeHighlights(bookmark.Text, *body.Highlights)
+			if err != nil {
+				respondArchiveError(c, err, "Failed to annotate bookmark")
+				return
+			}
+		}
+
+		if err := archive.AnnotateBookmark(c.Request.Context(), userID, tweetID, note, highlights, s.now()); err != nil {
+			respondArchiveError(c, err, "Failed to annotate bookmark")
+			return
+		}
+
+		s.respondBookmark(c, archive, userID, tweetID)
+	}
+}
+
+func (s *Server) respondBookmark(c *gin.Context, archive archive, userID, tweetID string) {
+	bookmark, err := archive.GetBookmark(c.Request.Context(), userID, tweetID)
+	if err != nil {
+		respondArchiveError(c, err, "Failed to fetch bookmark")
+		return
+	}
+
+	c.JSON(http.StatusOK, bookmark)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/services"
+)
+
+// loginTTL is how long a user has to complete the authorization on Twitter
+const loginTTL = 10 * time.Minute
+
+type pendingLogin struct {
+	codeVerifier string
+	expiresAt    time.Time
+}
+
+// loginStore keeps the PKCE code verifier of each pending authorization, keyed by state
+type loginStore struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	logins map[string]pendingLogin
+}
+
+func newLoginStore(ttl time.Duration) *loginStore {
+	return &loginStore{
+		ttl:    ttl,
+		logins: make(map[string]pendingLogin),
+	}
+}
+
+func (l *loginStore) put(state, codeVerifier string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for k, v := range l.logins {
+		if now.After(v.expiresAt) {
+			delete(l.logins, k)
+		}
+	}
+
+	l.logins[state] = pendingLogin{
+		codeVerifier: codeVerifier,
+		expiresAt:    now.Add(l.ttl),
+	}
+}
+
+// take returns the code verifier for state and forgets it, a state can only be used once
+func (l *loginStore) take(state string, now time.Time) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	login, ok := l.logins[state]
+	if !ok {
+		return "", false
+	}
+	delete(l.logins, state)
+
+	if now.After(login.expiresAt) {
+		return "", false
+	}
+
+	return login.codeVerifier, true
+}
+
+func (s *Server) login(service service, logins *loginStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		codeVerifier, err := services.GenerateCodeVerifier()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to start authorization",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		state, err := services.GenerateState()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to start authorization",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		logins.put(state, codeVerifier, s.now())
+
+		c.Redirect(http.StatusFound, service.AuthorizeURL(state, services.GenerateCodeChallenge(codeVerifier)))
+	}
+}
+
+func (s *Server) callback(service service, logins *loginStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if errCode := c.Query("error"); errCode != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Authorization denied",
+				"details": errCode,
+			})
+			return
+		}
+
+		codeVerifier, ok := logins.take(c.Query("state"), s.now())
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired state"})
+			return
+		}
+
+		code := c.Query("code")
+		if code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing authorization code"})
+			return
+		}
+
+		user, err := service.Authenticate(c.Request.Context(), code, codeVerifier)
+		if err != nil {
+			respondError(c, err, "Failed to authenticate")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Twitter account connected",
+			"user":    user,
+		})
+	}
+}
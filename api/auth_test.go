@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"twitter-bookmarks/models"
+)
+
+// login starts an authorization on the server, authorizes it on the fake and returns the callback URL
+func (e *testEnv) login() string {
+	e.t.Helper()
+
+	w := e.do(http.MethodGet, "/auth/login", "")
+	expectStatus(e.t, w, http.StatusFound)
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		e.t.Fatalf("authorize status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+
+	return "/auth/callback?" + callback.RawQuery
+}
+
+func TestLoginCallback(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.AddUser(models.User{ID: "2", Username: "other", Name: "Other"})
+	e.fake.LoginAs("2")
+
+	w := e.do(http.MethodGet, "/auth/login", "")
+	expectStatus(t, w, http.StatusFound)
+
+	authorizeURL, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authorizeURL.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" || query.Get("state") == "" {
+		t.Errorf("authorize URL %s lacks the PKCE challenge or the state", authorizeURL)
+	}
+
+	w = e.do(http.MethodGet, e.login(), "")
+	expectStatus(t, w, http.StatusOK)
+
+	var body struct {
+		User models.User `json:"user"`
+	}
+	decode(t, w, &body)
+	if body.User.ID != "2" {
+		t.Errorf("connected account %q, want 2", body.User.ID)
+	}
+
+	var users struct {
+		Users []models.User `json:"users"`
+	}
+	w = e.do(http.MethodGet, "/users", "")
+	expectStatus(t, w, http.StatusOK)
+	decode(t, w, &users)
+	if len(users.Users) != 2 {
+		t.Errorf("got %d accounts, want 2", len(users.Users))
+	}
+}
+
+func TestCallbackInvalidState(t *testing.T) {
+	tests := []struct {
+		name     string
+		callback func(e *testEnv) string
+	}{
+		{"unknown state", func(e *testEnv) string { return "/auth/callback?code=code&state=unknown" }},
+		{"state used twice", func(e *testEnv) string {
+			callback := e.login()
+			expectStatus(e.t, e.do(http.MethodGet, callback, ""), http.StatusOK)
+			return callback
+		}},
+		{"denied", func(e *testEnv) string { return "/auth/callback?error=access_denied" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t)
+
+			expectStatus(t, e.do(http.MethodGet, tt.callback(e), ""), http.StatusBadRequest)
+		})
+	}
+}
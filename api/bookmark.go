@@ -2,83 +2,163 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
-	"twitter-bookmarks/api/middleware"
 	"twitter-bookmarks/models"
+	"twitter-bookmarks/services"
+	"twitter-bookmarks/store"
 )
 
 type service interface {
-	Authenticate(ctx context.Context, code string) (string, error)
-	GetBookmarks(ctx context.Context, token string) (*models.BookmarkResponse, error)
-	GetBookmarksAfterDate(ctx context.Context, token string, date time.Time) (*models.BookmarkResponse, error)
+	AuthorizeURL(state, codeChallenge string) string
+	Authenticate(ctx context.Context, code, codeVerifier string) (*models.User, error)
+	Revoke(ctx context.Context, userID string) error
+	Users(ctx context.Context) ([]models.User, error)
+	User(ctx context.Context, userID string) (*models.User, error)
+	Me(ctx context.Context, userID string, refresh bool) (*models.User, error)
+	RateLimits(userID string) []services.EndpointRateLimit
 }
 
-func (s *Server) authenticate(service service, codeVerifier string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		token, err := service.Authenticate(c.Request.Context(), codeVerifier)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to authenticate",
-				"details": err.Error(),
-			})
-			return
+// archive reads the bookmarks archived by the sync
+type archive interface {
+	ListBookmarks(ctx context.Context, userID string, filter store.BookmarkFilter) (*models.BookmarkResponse, error)
+	GetBookmark(ctx context.Context, userID, tweetID string) (*models.Bookmark, error)
+	BookmarkHistory(ctx context.Context, userID string, filter store.HistoryFilter) (*models.HistoryResponse, error)
+	SearchBookmarks(ctx context.Context, userID string, query store.SearchQuery) (*models.SearchResponse, error)
+	SetTags(ctx context.Context, userID, tweetID string, tags []string, now time.Time) error
+	RemoveTags(ctx context.Context, userID, tweetID string, tags []string) error
+	ListTags(ctx context.Context, userID string) ([]models.Tag, error)
+	MergeTags(ctx context.Context, userID string, from []string, to string) (int, error)
+	AnnotateBookmark(ctx context.Context, userID, tweetID, note string, highlights []models.Highlight, now time.Time) error
+	ListCollections(ctx context.Context, userID string) ([]models.Collection, error)
+	GetCollection(ctx context.Context, userID string, id int64) (*models.Collection, error)
+	CreateCollection(ctx context.Context, userID, name, description string, now time.Time) (*models.Collection, error)
+	UpdateCollection(ctx context.Context, userID string, id int64, update store.CollectionUpdate, now time.Time) error
+	DeleteCollection(ctx context.Context, userID string, id int64) error
+	AddToCollection(ctx context.Context, userID string, id int64, tweetIDs []string, now time.Time) error
+	MoveInCollection(ctx context.Context, userID string, id int64, tweetID string, position int, now time.Time) error
+	RemoveFromCollection(ctx context.Context, userID string, id int64, tweetID string, now time.Time) error
+	ListRules(ctx context.Context, userID string) ([]models.Rule, error)
+	GetRule(ctx context.Context, userID string, id int64) (*models.Rule, error)
+	CreateRule(ctx context.Context, userID string, rule *models.Rule, now time.Time) error
+	UpdateRule(ctx context.Context, userID string, rule *models.Rule, now time.Time) error
+	DeleteRule(ctx context.Context, userID string, id int64) error
+	MatchRules(ctx context.Context, userID string, rules []models.Rule, tweetIDs []string) ([]models.RuleMatches, error)
+	ApplyRules(ctx context.Context, userID string, rules []models.Rule, tweetIDs []string, now time.Time) ([]models.RuleMatches, error)
+	ThreadOf(ctx context.Context, userID, tweetID string) (*models.Thread, error)
+	DeleteArchive(ctx context.Context, userID string) error
+}
+
+// defaultLimit is the number of archived bookmarks returned when no limit is requested
+const defaultLimit = 20
+
+// bookmarkFilter reads the filter, order and page of archived bookmarks from the query parameters,
+// bookmarks are kept in state when none is requested
+func bookmarkFilter(c *gin.Context, state store.BookmarkState) (store.BookmarkFilter, error) {
+	filter := store.BookmarkFilter{
+		Authors: listQuery(c, "author"),
+		Tags:    listQuery(c, "tag"),
+		Lang:    c.Query("lang"),
+		State:   store.BookmarkState(c.DefaultQuery("state", string(state))),
+		Sort:    store.BookmarkSort(c.Query("sort")),
+	}
+
+	var err error
+	if filter.After, err = queryTime(c, "after"); err != nil {
+		return store.BookmarkFilter{}, err
+	}
+	if filter.Before, err = queryTime(c, "before"); err != nil {
+		return store.BookmarkFilter{}, err
+	}
+
+	for _, has := range listQuery(c, "has") {
+		switch has {
+		case "media":
+			filter.HasMedia = true
+		case "links":
+			filter.HasLinks = true
+		default:
+			return store.BookmarkFilter{}, errors.New("has must be media or links")
 		}
+	}
+
+	if filter.MinLikes, err = queryInt(c, "min_likes"); err != nil {
+		return store.BookmarkFilter{}, err
+	}
+	if filter.MinRetweets, err = queryInt(c, "min_retweets"); err != nil {
+		return store.BookmarkFilter{}, err
+	}
+
+	switch c.DefaultQuery("tag_mode", "all") {
+	case "any":
+		filter.AnyTag = true
+	case "all":
+	default:
+		return store.BookmarkFilter{}, errors.New("tag_mode must be all or any")
+	}
 
-		c.JSON(http.StatusOK, gin.H{"token": token})
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		filter.Ascending = true
+	case "desc":
+	default:
+		return store.BookmarkFilter{}, errors.New("order must be asc or desc")
 	}
+
+	if filter.Limit, filter.Offset, err = offsetPage(c, defaultLimit); err != nil {
+		return store.BookmarkFilter{}, err
+	}
+
+	return filter, filter.Validate()
 }
 
-func (s *Server) getBookmarks(service service) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		token, ok := c.Get(middleware.TwitterTokenKey)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			return
+// listQuery returns the values of a query parameter given several times or comma separated
+func listQuery(c *gin.Context, name string) []string {
+	var values []string
+	for _, value := range c.QueryArray(name) {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
 		}
+	}
 
-		fmt.Println(token)
+	return values
+}
 
-		response, err := service.GetBookmarks(c.Request.Context(), token.(string))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to fetch bookmarks",
-				"details": err.Error(),
-			})
-			return
-		}
+// queryInt reads an optional non negative integer from a query parameter
+func queryInt(c *gin.Context, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
 
-		c.JSON(http.StatusOK, response)
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
 	}
+
+	return n, nil
 }
 
-func (s *Server) getBookmarksWithDateFilter(service service) gin.HandlerFunc {
+func (s *Server) getBookmarks(archive archive) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		dateStr := c.Query("after")
-		afterDate, err := time.Parse(time.RFC3339, dateStr)
+		filter, err := bookmarkFilter(c, store.StateBookmarked)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Invalid date format. Use RFC3339",
-			})
-			return
-		}
-
-		token, ok := c.Get(middleware.TwitterTokenKey)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		response, err := service.GetBookmarksAfterDate(c.Request.Context(), token.(string), afterDate)
+		response, err := archive.ListBookmarks(c.Request.Context(), c.GetString(userIDKey), filter)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to fetch bookmarks",
-				"details": err.Error(),
-			})
+			respondError(c, err, "Failed to fetch bookmarks")
 			return
 		}
 
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services"
+	"twitter-bookmarks/services/twittertest"
+	"twitter-bookmarks/store"
+)
+
+func TestGetBookmarksPages(t *testing.T) {
+	e := newTestEnv(t)
+	bookmarks := twittertest.Bookmarks(1, 250)
+	e.fake.AddBookmarks(testUserID, bookmarks...)
+
+	if result := e.sync(services.SyncOptions{}); result.Pages != 3 || result.Added != 250 {
+		t.Fatalf("sync = %+v, want 250 bookmarks added from 3 pages", result)
+	}
+
+	var (
+		got    []string
+		cursor string
+		pages  int
+	)
+	for {
+		w := e.do(http.MethodGet, "/bookmarks?sort=created_at&limit=100&cursor="+cursor, "")
+		expectStatus(t, w, http.StatusOK)
+
+		var page models.BookmarkResponse
+		decode(t, w, &page)
+		for _, bookmark := range page.Bookmarks {
+			got = append(got, bookmark.TweetID)
+		}
+		pages++
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	want := make([]string, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		want = append(want, bookmark.TweetID)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bookmarks = %v, want %v", got, want)
+	}
+	if pages != 3 {
+		t.Errorf("read %d pages, want 3", pages)
+	}
+}
+
+func TestGetBookmarksInvalidPage(t *testing.T) {
+	e := newTestEnv(t)
+
+	for _, query := range []string{"limit=0", "limit=101", "cursor=-1", "cursor=x"} {
+		expectStatus(t, e.do(http.MethodGet, "/bookmarks?"+query, ""), http.StatusBadRequest)
+	}
+}
+
+func TestBookmarkFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  store.BookmarkFilter
+	}{
+		{"defaults", "", store.BookmarkFilter{State: store.StateBookmarked, Limit: defaultLimit}},
+		{"authors", "author=gopher,rustacean&author=+ziggy+", store.BookmarkFilter{
+			Authors: []string{"gopher", "rustacean", "ziggy"}, State: store.StateBookmarked, Limit: defaultLimit,
+		}},
+		{"all tags", "tag=go,news", store.BookmarkFilter{
+			Tags: []string{"go", "news"}, State: store.StateBookmarked, Limit: defaultLimit,
+		}},
+		{"any tag", "tag=go&tag=news&tag_mode=any", store.BookmarkFilter{
+			Tags: []string{"go", "news"}, AnyTag: true, State: store.StateBookmarked, Limit: defaultLimit,
+		}},
+		{"has", "has=media,links", store.BookmarkFilter{
+			HasMedia: true, HasLinks: true, State: store.StateBookmarked, Limit: defaultLimit,
+		}},
+		{"metrics", "min_likes=10&min_retweets=0", store.BookmarkFilter{
+			MinLikes: 10, State: store.StateBookmarked, Limit: defaultLimit,
+		}},
+		{"dates", "after=2023-01-01T00:00:00Z&before=2023-02-01T12:00:00%2B01:00", store.BookmarkFilter{
+			After:  time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			Before: time.Date(2023, 2, 1, 11, 0, 0, 0, time.UTC),
+			State:  store.StateBookmarked, Limit: defaultLimit,
+		}},
+		{"lang", "lang=fr", store.BookmarkFilter{Lang: "fr", State: store.StateBookmarked, Limit: defaultLimit}},
+		{"state", "state=removed", store.BookmarkFilter{State: store.StateRemoved, Limit: defaultLimit}},
+		{"sort", "sort=likes&order=asc", store.BookmarkFilter{
+			Sort: store.SortLikes, Ascending: true, State: store.StateBookmarked, Limit: defaultLimit,
+		}},
+		{"page", "limit=50&cursor=100", store.BookmarkFilter{State: store.StateBookmarked, Limit: 50, Offset: 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bookmarkFilter(testContext(http.MethodGet, "/bookmarks?"+tt.query), store.StateBookmarked)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.After.Equal(tt.want.After) || !got.Before.Equal(tt.want.Before) {
+				t.Errorf("range = [%s, %s], want [%s, %s]", got.After, got.Before, tt.want.After, tt.want.Before)
+			}
+			got.After, got.Before, tt.want.After, tt.want.Before = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filter = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBookmarkFilterInvalid(t *testing.T) {
+	for _, query := range []string{
+		"has=video", "tag_mode=some", "order=up", "sort=random", "state=gone", "min_likes=-1", "min_retweets=x",
+		"after=2023-01-01", "before=yesterday", "limit=0", "limit=101", "cursor=-5",
+	} {
+		t.Run(query, func(t *testing.T) {
+			if _, err := bookmarkFilter(testContext(http.MethodGet, "/bookmarks?"+query), store.StateBookmarked); err == nil {
+				t.Errorf("filter %q accepted", query)
+			}
+		})
+	}
+}
+
+func TestArchiveErrors(t *testing.T) {
+	e := newTestEnv(t)
+	expectStatus(t, e.do(http.MethodPost, "/collections", `{"name": "Reading"}`), http.StatusCreated)
+
+	tests := []struct {
+		name         string
+		method, path string
+		body         string
+		status       int
+		title        string
+		detail       string
+	}{
+		{"unknown bookmark", http.MethodPut, "/bookmarks/404/tags", `{"tags": ["go"]}`, http.StatusNotFound,
+			"Failed to tag bookmark", "Unknown bookmark"},
+		{"invalid tag", http.MethodPut, "/bookmarks/404/tags", `{"tags": ["go,rust"]}`, http.StatusBadRequest,
+			"Failed to tag bookmark", ""},
+		{"collection exists", http.MethodPost, "/collections", `{"name": "reading"}`, http.StatusConflict,
+			"Failed to create collection", ""},
+		{"unknown collection", http.MethodDelete, "/collections/404", "", http.StatusNotFound,
+			"Failed to delete collection", "Unknown collection"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := e.do(tt.method, tt.path, tt.body)
+			expectStatus(t, w, tt.status)
+			if w.Header().Get("Content-Type") != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want a problem", w.Header().Get("Content-Type"))
+			}
+
+			var p problem
+			decode(t, w, &p)
+			if p.Status != tt.status || p.Title != tt.title || p.Instance != tt.path || p.Detail == "" {
+				t.Errorf("problem = %+v, want status %d and title %q", p, tt.status, tt.title)
+			}
+			if tt.detail != "" && p.Detail != tt.detail {
+				t.Errorf("detail = %q, want %q", p.Detail, tt.detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/store"
+)
+
+func (s *Server) listCollections(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collections, err := archive.ListCollections(c.Request.Context(), c.GetString(userIDKey))
+		if err != nil {
+			respondError(c, err, "Failed to fetch collections")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"collections": collections})
+	}
+}
+
+func (s *Server) createCollection(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Name        string `json:"name" binding:"required"`
+			Description string `json:"description"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body, expected {\"name\": \"...\", \"description\": \"...\"}"})
+			return
+		}
+
+		collection, err := archive.CreateCollection(c.Request.Context(), c.GetString(userIDKey), body.Name, body.Description, s.now())
+		if err != nil {
+			respondArchiveError(c, err, "Failed to create collection")
+			return
+		}
+
+		c.JSON(http.StatusCreated, collection)
+	}
+}
+
+func (s *Server) getCollection(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := collectionID(c)
+		if !ok {
+			return
+		}
+
+		s.respondCollection(c, archive, id)
+	}
+}
+
+// updateCollection renames, describes or moves a collection, fields missing from the body are kept
+func (s *Server) updateCollection(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := collectionID(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Name        *string `json:"name"`
+			Description *string `json:"description"`
+			Position    *int    `json:"position"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body, expected {\"name\": \"...\", \"description\": \"...\", \"position\": 0}"})
+			return
+		}
+
+		update := store.CollectionUpdate{Name: body.Name, Description: body.Description, Position: body.Position}
+		if err := archive.UpdateCollection(c.Request.Context(), c.GetString(userIDKey), id, update, s.now()); err != nil {
+			respondArchiveError(c, err, "Failed to update collection")
+			return
+		}
+
+		s.respondCollection(c, archive, id)
+	}
+}
+
+func (s *Server) deleteCollection(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := collectionID(c)
+		if !ok {
+			return
+		}
+
+		if err := archive.DeleteCollection(c.Request.Context(), c.GetString(userIDKey), id); err != nil {
+			respondArchiveError(c, err, "Failed to delete collection")
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// getCollectionBookmarks lists the bookmarks of a collection with the filters of /bookmarks, they
+// are returned in the order of the collection unless another sort is requested
+func (s *Server) getCollectionBookmarks(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := collectionID(c)
+		if !ok {
+			return
+		}
+
+		filter, err := bookmarkFilter(c, store.AllBookmarks)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter.Collection = id
+		if filter.Sort == "" {
+			filter.Sort = store.SortPosition
+			filter.Ascending = c.Query("order") != "desc"
+		}
+
+		userID := c.GetString(userIDKey)
+		if _, err := archive.GetCollection(c.Request.Context(), userID, id); err != nil {
+			respondArchiveError(c, err, "Failed to fetch collection")
+			return
+		}
+
+		response, err := archive.ListBookmarks(c.Request.Context(), userID, filter)
+		if err != nil {
+			respondError(c, err, "Failed to fetch bookmarks")
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func (s *Server) addToCollection(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := collectionID(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			TweetIDs []string `json:"tweet_ids" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body, expected {\"tweet_ids\": [...]}"})
+			return
+		}
+
+		if err := archive.AddToCollection(c.Request.Context(), c.GetString(userIDKey), id, body.TweetIDs, s.now()); err != nil {
+			respondArchiveError(c, err, "Failed to add bookmarks to collection")
+			return
+		}
+
+		s.respondCollection(c, archive, id)
+	}
+}
+
+func (s *Server) moveInCollection(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := collectionID(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Position *int `json:"position" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body, expected {\"position\": 0}"})
+			return
+		}
+
+		err := archive.MoveInCollection(c.Request.Context(), c.GetString(userIDKey), id, c.Param("tweet"), *body.Position, s.now())
+		if err != nil {
+			respondArchiveError(c, err, "Failed to move bookmark")
+			return
+		}
+
+		s.respondCollection(c, archive, id)
+	}
+}
+
+func (s *Server) removeFromCollection(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := collectionID(c)
+		if !ok {
+			return
+		}
+
+		if err := archive.RemoveFromCollection(c.Request.Context(), c.GetString(userIDKey), id, c.Param("tweet"), s.now()); err != nil {
+			respondArchiveError(c, err, "Failed to remove bookmark from collection")
+			return
+		}
+
+		s.respondCollection(c, archive, id)
+	}
+}
+
+func (s *Server) respondCollection(c *gin.Context, archive archive, id int64) {
+	collection, err := archive.GetCollection(c.Request.Context(), c.GetString(userIDKey), id)
+	if err != nil {
+		respondArchiveError(c, err, "Failed to fetch collection")
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+func collectionID(c *gin.Context) (int64, bool) {
+	return pathID(c, "collection", "Unknown collection")
+}
+
+// pathID reads the ID in the path parameter name, responding with a 404 and unknown when it is invalid
+func pathID(c *gin.Context, name, unknown string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": unknown})
+		return 0, false
+	}
+
+	return id, true
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/services"
+	"twitter-bookmarks/store"
+)
+
+// problem is an RFC 7807 problem details response body
+type problem struct {
+	Type     string                 `json:"type"`
+	Title    string                 `json:"title"`
+	Status   int                    `json:"status"`
+	Detail   string                 `json:"detail,omitempty"`
+	Instance string                 `json:"instance,omitempty"`
+	Errors   []services.ErrorDetail `json:"errors,omitempty"`
+}
+
+// respondError responds with the problem matching err, title describes the operation that failed
+func respondError(c *gin.Context, err error, title string) {
+	p := newProblem(c, http.StatusInternalServerError, title, err.Error())
+
+	var (
+		rateLimitErr *services.RateLimitError
+		apiErr       *services.APIError
+	)
+
+	switch {
+	case errors.Is(err, services.ErrNotAuthenticated):
+		p.Status = http.StatusUnauthorized
+		p.Detail = "Twitter account not connected, visit /auth/login"
+	case errors.As(err, &rateLimitErr):
+		p.Status = http.StatusTooManyRequests
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))))
+	case errors.As(err, &apiErr):
+		p.Status = upstreamStatus(apiErr.StatusCode)
+		p.Errors = apiErr.Errors
+		if apiErr.Type != "" {
+			p.Type = apiErr.Type
+			p.Title = apiErr.Title
+		}
+		if apiErr.Detail != "" {
+			p.Detail = apiErr.Detail
+		}
+	}
+
+	writeProblem(c, p)
+}
+
+// newProblem returns a problem about the request of c
+func newProblem(c *gin.Context, status int, title, detail string) problem {
+	return problem{
+		Type:     "about:blank",
+		Title:    title,
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request.URL.Path,
+	}
+}
+
+// writeProblem responds with p as application/problem+json
+func writeProblem(c *gin.Context, p problem) {
+	c.Header("Content-Type", "application/problem+json")
+	c.JSON(p.Status, p)
+}
+
+// upstreamStatus maps the status of a Twitter API error to the status returned to clients,
+// errors that are not caused by the client become a 502 Bad Gateway
+func upstreamStatus(status int) int {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests:
+		return status
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// respondArchiveError responds to the errors of the operations on archived bookmarks
+func respondArchiveError(c *gin.Context, err error, title string) {
+	switch {
+	case errors.Is(err, store.ErrCollectionNotFound):
+		writeProblem(c, newProblem(c, http.StatusNotFound, title, "Unknown collection"))
+	case errors.Is(err, store.ErrRuleNotFound):
+		writeProblem(c, newProblem(c, http.StatusNotFound, title, "Unknown rule"))
+	case errors.Is(err, store.ErrNotFound):
+		writeProblem(c, newProblem(c, http.StatusNotFound, title, "Unknown bookmark"))
+	case errors.Is(err, store.ErrCollectionExists):
+		writeProblem(c, newProblem(c, http.StatusConflict, title, err.Error()))
+	case errors.Is(err, store.ErrInvalidTag), errors.Is(err, store.ErrInvalidAnnotation), errors.Is(err, store.ErrInvalidCollection),
+		errors.Is(err, store.ErrInvalidRule):
+		writeProblem(c, newProblem(c, http.StatusBadRequest, title, err.Error()))
+	default:
+		respondError(c, err, title)
+	}
+}
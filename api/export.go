@@ -0,0 +1,187 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services"
+	"twitter-bookmarks/store"
+)
+
+// exportBookmarks exports every archived bookmark kept by the filter as JSON or markdown, along
+// with their tags, notes and highlights. Mirrored media point at their local copy.
+func (s *Server) exportBookmarks(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.DefaultQuery("format", "json")
+		if format != "json" && format != "markdown" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or markdown"})
+			return
+		}
+
+		filter, err := bookmarkFilter(c, store.AllBookmarks)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		bookmarks := make([]models.Bookmark, 0)
+		filter.Limit, filter.Offset = services.MaxPageSize, 0
+		for {
+			response, err := archive.ListBookmarks(c.Request.Context(), c.GetString(userIDKey), filter)
+			if err != nil {
+				respondError(c, err, "Failed to export bookmarks")
+				return
+			}
+			bookmarks = append(bookmarks, response.Bookmarks...)
+
+			if response.NextCursor == "" {
+				break
+			}
+			filter.Offset += filter.Limit
+		}
+
+		if s.media != nil {
+			if err := s.localMedia(c, bookmarks); err != nil {
+				respondError(c, err, "Failed to export bookmarks")
+				return
+			}
+		}
+
+		if format == "markdown" {
+			c.Header("Content-Disposition", `attachment; filename="bookmarks.md"`)
+			c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(markdown(bookmarks)))
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="bookmarks.json"`)
+		c.JSON(http.StatusOK, gin.H{"bookmarks": bookmarks})
+	}
+}
+
+// markdown renders bookmarks as a markdown document, highlights are rendered in bold
+func markdown(bookmarks []models.Bookmark) string {
+	var b strings.Builder
+
+	b.WriteString("# Bookmarks\n")
+	for _, bookmark := range bookmarks {
+		fmt.Fprintf(&b, "\n## @%s", authorName(bookmark.Author))
+		if !bookmark.CreatedAt.IsZero() {
+			fmt.Fprintf(&b, " — %s", bookmark.CreatedAt.Format("2006-01-02"))
+		}
+		b.WriteString("\n\n")
+
+		for _, line := range strings.Split(highlighted(bookmark.Text, bookmark.Highlights), "\n") {
+			fmt.Fprintf(&b, "> %s\n", line)
+		}
+
+		for _, media := range bookmark.Media {
+			if image := mediaImage(media); image != "" {
+				fmt.Fprintf(&b, "\n![%s](%s)\n", strings.ReplaceAll(media.AltText, "\n", " "), image)
+			}
+		}
+
+		for _, ref := range []struct {
+			label string
+			tweet *models.Tweet
+		}{
+			{"In reply to", bookmark.InReplyTo},
+			{"Quoting", bookmark.QuotedTweet},
+			{"Retweet of", bookmark.RetweetOf},
+		} {
+			if ref.tweet != nil {
+				markdownReference(&b, ref.label, *ref.tweet)
+			}
+		}
+
+		fmt.Fprintf(&b, "\n%s\n", tweetURL(bookmark.Author, bookmark.TweetID))
+
+		if len(bookmark.Tags) > 0 {
+			fmt.Fprintf(&b, "\nTags: %s\n", strings.Join(bookmark.Tags, ", "))
+		}
+
+		if bookmark.Note != "" {
+			fmt.Fprintf(&b, "\n### Note\n\n%s\n", strings.TrimSpace(bookmark.Note))
+		}
+
+		b.WriteString("\n---\n")
+	}
+
+	return b.String()
+}
+
+// markdownReference renders a tweet referenced by a bookmark as a quote below its label
+func markdownReference(b *strings.Builder, label string, tweet models.Tweet) {
+	fmt.Fprintf(b, "\n%s @%s:\n\n", label, authorName(tweet.Author))
+
+	for _, line := range strings.Split(tweet.Text, "\n") {
+		fmt.Fprintf(b, "> %s\n", line)
+	}
+
+	for _, media := range tweet.Media {
+		if image := mediaImage(media); image != "" {
+			fmt.Fprintf(b, ">\n> ![%s](%s)\n", strings.ReplaceAll(media.AltText, "\n", " "), image)
+		}
+	}
+
+	fmt.Fprintf(b, ">\n> %s\n", tweetURL(tweet.Author, tweet.ID))
+}
+
+// highlighted wraps the highlights of text in bold, overlapping highlights are merged
+func highlighted(text string, highlights []models.Highlight) string {
+	runes := []rune(text)
+
+	var (
+		b   strings.Builder
+		pos int
+	)
+	for i := 0; i < len(highlights); i++ {
+		start, end := highlights[i].Start, highlights[i].End
+		for i+1 < len(highlights) && highlights[i+1].Start <= end {
+			i++
+			if highlights[i].End > end {
+				end = highlights[i].End
+			}
+		}
+		if start < pos || end > len(runes) {
+			continue
+		}
+
+		b.WriteString(string(runes[pos:start]))
+		b.WriteString("**" + string(runes[start:end]) + "**")
+		pos = end
+	}
+	b.WriteString(string(runes[pos:]))
+
+	return b.String()
+}
+
+// mediaImage returns the image showing a media, the preview of videos and GIFs
+func mediaImage(media models.Media) string {
+	if media.URL != "" {
+		return media.URL
+	}
+
+	return media.PreviewImageURL
+}
+
+// authorName returns the username of an author, or their ID when the username is unknown
+func authorName(author models.Author) string {
+	if author.Username == "" {
+		return author.ID
+	}
+
+	return author.Username
+}
+
+func tweetURL(author models.Author, tweetID string) string {
+	username := author.Username
+	if username == "" {
+		username = "i/web"
+	}
+
+	return fmt.Sprintf("https://twitter.com/%s/status/%s", username, tweetID)
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"testing"
+
+	"twitter-bookmarks/models"
+)
+
+func TestHighlighted(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		highlights []models.Highlight
+		want       string
+	}{
+		{"none", "hello world", nil, "hello world"},
+		{"one", "hello world", []models.Highlight{{Start: 6, End: 11}}, "hello **world**"},
+		{"several", "go and rust", []models.Highlight{{Start: 0, End: 2}, {Start: 7, End: 11}}, "**go** and **rust**"},
+		{"overlapping", "abcdefgh", []models.Highlight{{Start: 1, End: 4}, {Start: 2, End: 6}}, "a**bcdef**gh"},
+		{"contained", "abcdefgh", []models.Highlight{{Start: 1, End: 6}, {Start: 2, End: 3}}, "a**bcdef**gh"},
+		{"adjacent", "abcdefgh", []models.Highlight{{Start: 0, End: 2}, {Start: 2, End: 4}}, "**abcd**efgh"},
+		{"unicode", "café 日本語", []models.Highlight{{Start: 3, End: 4}, {Start: 5, End: 7}}, "caf**é** **日本**語"},
+		{"out of range", "hello", []models.Highlight{{Start: 2, End: 9}}, "hello"},
+		{"out of range skipped", "hello world", []models.Highlight{{Start: 0, End: 5}, {Start: 6, End: 20}}, "**hello** world"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlighted(tt.text, tt.highlights); got != tt.want {
+				t.Errorf("highlighted(%q, %+v) = %q, want %q", tt.text, tt.highlights, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/config"
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services"
+	"twitter-bookmarks/services/twittertest"
+	"twitter-bookmarks/store"
+)
+
+// testUserID is the account connected in the environments of newTestEnv
+const testUserID = "1"
+
+// testAPIKey may read every account of the environments of newTestEnv
+const testAPIKey = "test-key"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// testEnv is a Server backed by a SQLite archive and a fake Twitter API, with an account already connected
+type testEnv struct {
+	t       *testing.T
+	fake    *twittertest.Server
+	store   *store.SQLiteStore
+	twitter *services.TwitterService
+	syncer  *services.Syncer
+	jobs    *services.SyncJobs
+	server  *Server
+}
+
+// newTestEnv creates a testEnv, failed Twitter requests are retried without waiting
+func newTestEnv(t *testing.T, options ...Options) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+
+	db, err := store.OpenSQLite(filepath.Join(t.TempDir(), "bookmarks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	archive, err := store.NewSQLiteStore(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := twittertest.NewServer()
+	t.Cleanup(fake.Close)
+
+	fake.ConnectUser(t, archive, models.User{ID: testUserID, Username: "reader", Name: "Reader", UpdatedAt: time.Now()})
+
+	twitter := services.NewTwitterService("client", "", "http://localhost/auth/callback", archive,
+		services.WithBaseURL(fake.URL),
+		services.WithAuthBaseURL(fake.URL),
+		services.WithRateLimitPolicy(services.RateLimitPolicy{MaxWait: time.Second, MaxRetries: 3}),
+	)
+	syncer := services.NewSyncer(twitter, archive, archive, archive)
+	scheduler := services.NewScheduler(syncer, services.SchedulerConfig{})
+	jobs := services.NewSyncJobs(syncer)
+	keys := map[string][]string{testAPIKey: {config.AllAccounts}}
+
+	options = append([]Options{WithRegisterRoutes(twitter, archive, scheduler, jobs, syncer, keys)}, options...)
+
+	return &testEnv{
+		t:       t,
+		fake:    fake,
+		store:   archive,
+		twitter: twitter,
+		syncer:  syncer,
+		jobs:    jobs,
+		server:  New("0", options...),
+	}
+}
+
+// do sends a request authenticated with testAPIKey, body is sent as JSON when not empty
+func (e *testEnv) do(method, path, body string) *httptest.ResponseRecorder {
+	e.t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-API-Key", testAPIKey)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	w := httptest.NewRecorder()
+	e.server.handler.ServeHTTP(w, req)
+
+	return w
+}
+
+// testContext returns the context of a request handled by gin, to test the helpers reading requests
+func testContext(method, target string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(method, target, nil)
+
+	return c
+}
+
+// decode decodes the JSON body of a response into v
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	body, err := io.ReadAll(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("failed to decode %s: %v", body, err)
+	}
+}
+
+// expectStatus fails the test when a response does not have status
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d, body = %s", w.Code, status, w.Body.String())
+	}
+}
+
+// sync archives the bookmarks of the test account from the fake
+func (e *testEnv) sync(opts services.SyncOptions) *services.SyncResult {
+	e.t.Helper()
+
+	result, err := e.syncer.Sync(context.Background(), testUserID, opts)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+
+	return result
+}
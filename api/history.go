@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/store"
+)
+
+func (s *Server) getHistory(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			filter store.HistoryFilter
+			err    error
+		)
+		if filter.From, err = queryTime(c, "from"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if filter.To, err = queryTime(c, "to"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if filter.Limit, filter.Offset, err = offsetPage(c, defaultLimit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		response, err := archive.BookmarkHistory(c.Request.Context(), c.GetString(userIDKey), filter)
+		if err != nil {
+			respondError(c, err, "Failed to fetch history")
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// queryTime reads an optional RFC3339 time from a query parameter, it returns the zero time when absent
+func queryTime(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s date format, use RFC3339", name)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services/twittertest"
+)
+
+// historyEnv archives 25 bookmarks at added then removes the first one at removed
+func historyEnv(t *testing.T, added, removed time.Time) *testEnv {
+	t.Helper()
+
+	e := newTestEnv(t)
+	ctx := context.Background()
+
+	bookmarks := twittertest.Bookmarks(1, 25)
+	if _, err := e.store.SaveBookmarks(ctx, testUserID, bookmarks, nil, added); err != nil {
+		t.Fatal(err)
+	}
+
+	var keep []string
+	for _, bookmark := range bookmarks[1:] {
+		keep = append(keep, bookmark.TweetID)
+	}
+	if n, err := e.store.RemoveBookmarks(ctx, testUserID, keep, removed); err != nil || n != 1 {
+		t.Fatalf("RemoveBookmarks() = %d, %v, want 1 bookmark removed", n, err)
+	}
+
+	return e
+}
+
+func TestGetHistory(t *testing.T) {
+	added := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	removed := added.Add(24 * time.Hour)
+	e := historyEnv(t, added, removed)
+
+	var (
+		events []models.BookmarkEvent
+		cursor string
+		pages  int
+	)
+	for {
+		w := e.do(http.MethodGet, "/bookmarks/history?cursor="+cursor, "")
+		expectStatus(t, w, http.StatusOK)
+
+		var page models.HistoryResponse
+		decode(t, w, &page)
+		events = append(events, page.Events...)
+		pages++
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	if len(events) != 26 || pages != 2 {
+		t.Fatalf("got %d events in %d pages, want 26 events in 2 pages", len(events), pages)
+	}
+
+	first := events[0]
+	if first.Type != models.BookmarkRemoved || first.TweetID != "1" || !first.OccurredAt.Equal(removed) ||
+		first.Bookmark == nil || first.Bookmark.Bookmarked {
+		t.Errorf("first event = %+v, want the removal of 1", first)
+	}
+
+	seen := make(map[string]bool)
+	for _, event := range events[1:] {
+		if event.Type != models.BookmarkAdded || !event.OccurredAt.Equal(added) {
+			t.Errorf("event = %+v, want an addition at %v", event, added)
+		}
+		seen[event.TweetID] = true
+	}
+	if len(seen) != 25 {
+		t.Errorf("%d bookmarks added, want 25", len(seen))
+	}
+}
+
+func TestGetHistoryRange(t *testing.T) {
+	added := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	removed := added.Add(24 * time.Hour)
+	e := historyEnv(t, added, removed)
+
+	tests := []struct {
+		name  string
+		query url.Values
+		added int
+		total int
+	}{
+		{"from the removal", url.Values{"from": {removed.Format(time.RFC3339)}}, 0, 1},
+		{"to the removal", url.Values{"to": {removed.Format(time.RFC3339)}, "limit": {"100"}}, 25, 25},
+		{"around the removal", url.Values{"from": {removed.Add(-time.Hour).Format(time.RFC3339)},
+			"to": {removed.Add(time.Hour).Format(time.RFC3339)}}, 0, 1},
+		{"before any event", url.Values{"to": {added.Format(time.RFC3339)}}, 0, 0},
+		{"limited", url.Values{"limit": {"5"}, "cursor": {"1"}}, 5, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := e.do(http.MethodGet, "/bookmarks/history?"+tt.query.Encode(), "")
+			expectStatus(t, w, http.StatusOK)
+
+			var page models.HistoryResponse
+			decode(t, w, &page)
+
+			additions := 0
+			for _, event := range page.Events {
+				if event.Type == models.BookmarkAdded {
+					additions++
+				}
+			}
+			if len(page.Events) != tt.total || additions != tt.added {
+				t.Errorf("got %d events with %d additions, want %d with %d", len(page.Events), additions, tt.total, tt.added)
+			}
+		})
+	}
+}
+
+func TestGetHistoryInvalid(t *testing.T) {
+	e := newTestEnv(t)
+
+	for _, query := range []string{
+		"from=yesterday",
+		"to=2023-03-01",
+		"from=2023-03-01T12:00:00",
+		"limit=0",
+		"limit=101",
+		"limit=ten",
+		"cursor=-1",
+		"cursor=next",
+	} {
+		w := e.do(http.MethodGet, "/bookmarks/history?"+query, "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
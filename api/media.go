@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services"
+	"twitter-bookmarks/store"
+)
+
+type mediaFiles interface {
+	Open(ctx context.Context, hash string) (*models.MediaFile, string, error)
+	Files(ctx context.Context, urls []string) (map[string]models.MediaFile, error)
+}
+
+// WithMedia serves the media mirrored by media from /media/{hash} and points the exports at them
+// under publicURL, the URL the server is reached at. The route needs no API key, the files are only
+// reachable through the hash of their content.
+func WithMedia(media mediaFiles, publicURL string) Options {
+	return func(s *Server) {
+		s.media = media
+		s.publicURL = strings.TrimSuffix(publicURL, "/")
+		s.handler.GET("/media/:hash", s.getMedia(media))
+	}
+}
+
+func (s *Server) getMedia(media mediaFiles) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file, path, err := media.Open(c.Request.Context(), c.Param("hash"))
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Unknown media"})
+				return
+			}
+			respondError(c, err, "Failed to fetch media")
+			return
+		}
+
+		c.Header("Content-Type", file.MIMEType)
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.File(path)
+	}
+}
+
+// localMedia points the media of bookmarks and of the tweets they reference at their mirrored
+// copy, media that are not mirrored keep their Twitter URL
+func (s *Server) localMedia(c *gin.Context, bookmarks []models.Bookmark) error {
+	var urls []string
+	for i := range bookmarks {
+		for _, media := range bookmarkMedia(&bookmarks[i]) {
+			for _, m := range *media {
+				urls = append(urls, services.MediaURLs(m)...)
+			}
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	files, err := s.media.Files(c.Request.Context(), urls)
+	if err != nil {
+		return err
+	}
+
+	local := func(url string) string {
+		if file, ok := files[url]; ok {
+			return s.publicURL + "/media/" + file.Hash
+		}
+		return url
+	}
+
+	for i := range bookmarks {
+		for _, media := range bookmarkMedia(&bookmarks[i]) {
+			*media = localURLs(*media, local)
+		}
+	}
+
+	return nil
+}
+
+// bookmarkMedia returns the media of a bookmark and of the tweets it references
+func bookmarkMedia(bookmark *models.Bookmark) []*[]models.Media {
+	media := []*[]models.Media{&bookmark.Media}
+	for _, tweet := range []*models.Tweet{bookmark.QuotedTweet, bookmark.InReplyTo, bookmark.RetweetOf} {
+		if tweet != nil {
+			media = append(media, &tweet.Media)
+		}
+	}
+
+	return media
+}
+
+// localURLs returns a copy of media with their URLs rewritten by local
+func localURLs(media []models.Media, local func(string) string) []models.Media {
+	media = append([]models.Media(nil), media...)
+	for i := range media {
+		media[i].URL = local(media[i].URL)
+		media[i].PreviewImageURL = local(media[i].PreviewImageURL)
+
+		variants := append([]models.MediaVariant(nil), media[i].Variants...)
+		for j := range variants {
+			variants[j].URL = local(variants[j].URL)
+		}
+		media[i].Variants = variants
+	}
+
+	return media
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services"
+	"twitter-bookmarks/services/twittertest"
+)
+
+// testPublicURL is the URL the servers of newMediaEnv are reached at
+const testPublicURL = "https://bookmarks.example.com"
+
+// newMediaEnv creates a testEnv serving the mirrored media, with a bookmark whose photo holding
+// content is mirrored. It returns the Twitter URL of the photo.
+func newMediaEnv(t *testing.T, content []byte) (*testEnv, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(content)
+	}))
+	t.Cleanup(images.Close)
+
+	e := newTestEnv(t)
+	mirror := services.NewMediaMirror(e.store, services.MediaMirrorConfig{Dir: t.TempDir()})
+	WithMedia(mirror, testPublicURL+"/")(e.server)
+
+	photo := images.URL + "/photo.jpg"
+	bookmarks := twittertest.Bookmarks(1, 1)
+	bookmarks[0].Media = []models.Media{{MediaKey: "3_1", Type: "photo", URL: photo}}
+	if _, err := e.store.SaveBookmarks(ctx, testUserID, bookmarks, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mirror.Mirror(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return e, photo
+}
+
+func TestGetMedia(t *testing.T) {
+	content := []byte("a photo of a gopher")
+	e, _ := newMediaEnv(t, content)
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	// the media are served without an API key
+	w := httptest.NewRecorder()
+	e.server.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/media/"+hash, nil))
+	expectStatus(t, w, http.StatusOK)
+	if got := w.Header().Get("Content-Type"); got != "image/jpeg" {
+		t.Errorf("Content-Type = %q, want image/jpeg", got)
+	}
+	if got := w.Body.String(); got != string(content) {
+		t.Errorf("body = %q, want %q", got, content)
+	}
+
+	unknown := sha256.Sum256([]byte("never mirrored"))
+	for _, hash := range []string{"not-a-hash", strings.ToUpper(hash), "..%2F..%2Fbookmarks.db", hex.EncodeToString(unknown[:])} {
+		expectStatus(t, e.do(http.MethodGet, "/media/"+hash, ""), http.StatusNotFound)
+	}
+}
+
+func TestExportLocalMedia(t *testing.T) {
+	content := []byte("a photo of a gopher")
+	e, photo := newMediaEnv(t, content)
+
+	sum := sha256.Sum256(content)
+	want := testPublicURL + "/media/" + hex.EncodeToString(sum[:])
+
+	// the links ignore the host and scheme claimed by the client
+	req := httptest.NewRequest(http.MethodGet, "/bookmarks/export", nil)
+	req.Header.Set("X-API-Key", testAPIKey)
+	req.Header.Set("X-Forwarded-Proto", "javascript")
+	req.Host = "attacker.example.com"
+	w := httptest.NewRecorder()
+	e.server.handler.ServeHTTP(w, req)
+	expectStatus(t, w, http.StatusOK)
+
+	var export struct {
+		Bookmarks []models.Bookmark `json:"bookmarks"`
+	}
+	decode(t, w, &export)
+	if len(export.Bookmarks) != 1 || len(export.Bookmarks[0].Media) != 1 {
+		t.Fatalf("exported %+v, want a bookmark with a photo", export.Bookmarks)
+	}
+	if got := export.Bookmarks[0].Media[0].URL; got != want {
+		t.Errorf("photo URL = %q, want %q instead of %s", got, want, photo)
+	}
+}
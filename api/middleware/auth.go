@@ -1,50 +1,39 @@
 package middleware
 
 import (
-	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-)
 
-// TwitterTokenKey is the key for the Twitter token in the context
-const TwitterTokenKey = "TWITTER_TOKEN"
+	"twitter-bookmarks/config"
+)
 
-type service interface {
-	Authenticate(ctx context.Context) (string, error)
-}
+// AccountsKey is the key for the Twitter user IDs the API key may read in the context
+const AccountsKey = "ACCOUNTS"
 
-// Auth is a middleware to authenticate the user
-func Auth(secretKey string) gin.HandlerFunc {
+// Auth is a middleware to authenticate the user, keys maps each API key to the accounts it may read
+func Auth(keys map[string][]string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.GetHeader("X-API-KEY")
-		if token != secretKey {
+		accounts, ok := keys[token]
+		if token == "" || !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
 
+		c.Set(AccountsKey, accounts)
 		c.Next()
 	}
 }
 
-// GetTokenFromTwitter returns the token from the Twitter header
-func GetTokenFromTwitter(service service) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		_, exist := c.Get(TwitterTokenKey)
-		if exist {
-			c.Next()
-
-			return
+// CanRead reports whether the API key of the request may read the account
+func CanRead(c *gin.Context, userID string) bool {
+	for _, account := range c.GetStringSlice(AccountsKey) {
+		if account == config.AllAccounts || account == userID {
+			return true
 		}
-
-		token, err := service.Authenticate(c.Request.Context())
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
-			return
-		}
-		c.Set(TwitterTokenKey, token)
-		c.Next()
 	}
+
+	return false
 }
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/store"
+)
+
+// ruleBody is the body creating or replacing a rule, rules are enabled unless stated otherwise
+type ruleBody struct {
+	Name    string                `json:"name"`
+	Enabled *bool                 `json:"enabled"`
+	Match   models.RuleConditions `json:"match"`
+	Actions models.RuleActions    `json:"actions"`
+}
+
+func (b ruleBody) rule() models.Rule {
+	rule := models.Rule{Name: b.Name, Enabled: true, Match: b.Match, Actions: b.Actions}
+	if b.Enabled != nil {
+		rule.Enabled = *b.Enabled
+	}
+
+	return rule
+}
+
+func (s *Server) listRules(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, err := archive.ListRules(c.Request.Context(), c.GetString(userIDKey))
+		if err != nil {
+			respondError(c, err, "Failed to fetch rules")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"rules": rules})
+	}
+}
+
+// createRule saves a rule, or with ?dry_run=true returns the archived bookmarks it would match
+// without saving it
+func (s *Server) createRule(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body ruleBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body, expected {\"name\": \"...\", \"match\": {...}, \"actions\": {...}}"})
+			return
+		}
+
+		rule := body.rule()
+		if c.Query("dry_run") == "true" {
+			if err := store.NormalizeRule(&rule); err != nil {
+				respondArchiveError(c, err, "Failed to match rule")
+				return
+			}
+
+			s.respondRuleMatches(c, archive, []models.Rule{rule}, true)
+			return
+		}
+
+		if err := archive.CreateRule(c.Request.Context(), c.GetString(userIDKey), &rule, s.now()); err != nil {
+			respondArchiveError(c, err, "Failed to create rule")
+			return
+		}
+
+		c.JSON(http.StatusCreated, rule)
+	}
+}
+
+func (s *Server) getRule(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := ruleID(c)
+		if !ok {
+			return
+		}
+
+		rule, err := archive.GetRule(c.Request.Context(), c.GetString(userIDKey), id)
+		if err != nil {
+			respondArchiveError(c, err, "Failed to fetch rule")
+			return
+		}
+
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+func (s *Server) updateRule(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := ruleID(c)
+		if !ok {
+			return
+		}
+
+		var body ruleBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body, expected {\"name\": \"...\", \"match\": {...}, \"actions\": {...}}"})
+			return
+		}
+
+		userID := c.GetString(userIDKey)
+		rule := body.rule()
+		rule.ID = id
+		if err := archive.UpdateRule(c.Request.Context(), userID, &rule, s.now()); err != nil {
+			respondArchiveError(c, err, "Failed to update rule")
+			return
+		}
+
+		updated, err := archive.GetRule(c.Request.Context(), userID, id)
+		if err != nil {
+			respondArchiveError(c, err, "Failed to fetch rule")
+			return
+		}
+
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func (s *Server) deleteRule(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := ruleID(c)
+		if !ok {
+			return
+		}
+
+		if err := archive.DeleteRule(c.Request.Context(), c.GetString(userIDKey), id); err != nil {
+			respondArchiveError(c, err, "Failed to delete rule")
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// applyRules applies the enabled rules to every archived bookmark, or only lists the bookmarks they
+// match with ?dry_run=true
+func (s *Server) applyRules(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, err := archive.ListRules(c.Request.Context(), c.GetString(userIDKey))
+		if err != nil {
+			respondError(c, err, "Failed to fetch rules")
+			return
+		}
+
+		enabled := make([]models.Rule, 0, len(rules))
+		for _, rule := range rules {
+			if rule.Enabled {
+				enabled = append(enabled, rule)
+			}
+		}
+
+		s.respondRuleMatches(c, archive, enabled, c.Query("dry_run") == "true")
+	}
+}
+
+// applyRule applies a rule to every archived bookmark, even when it is disabled, or only lists
+// the bookmarks it matches with ?dry_run=true
+func (s *Server) applyRule(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := ruleID(c)
+		if !ok {
+			return
+		}
+
+		rule, err := archive.GetRule(c.Request.Context(), c.GetString(userIDKey), id)
+		if err != nil {
+			respondArchiveError(c, err, "Failed to fetch rule")
+			return
+		}
+
+		s.respondRuleMatches(c, archive, []models.Rule{*rule}, c.Query("dry_run") == "true")
+	}
+}
+
+func (s *Server) respondRuleMatches(c *gin.Context, archive archive, rules []models.Rule, dryRun bool) {
+	userID := c.GetString(userIDKey)
+
+	var (
+		matches []models.RuleMatches
+		err     error
+	)
+	if dryRun {
+		matches, err = archive.MatchRules(c.Request.Context(), userID, rules, nil)
+	} else {
+		matches, err = archive.ApplyRules(c.Request.Context(), userID, rules, nil, s.now())
+	}
+	if err != nil {
+		respondArchiveError(c, err, "Failed to apply rules")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dry_run": dryRun, "matches": matches})
+}
+
+func ruleID(c *gin.Context) (int64, bool) {
+	return pathID(c, "rule", "Unknown rule")
+}
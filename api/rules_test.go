@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services"
+	"twitter-bookmarks/services/twittertest"
+)
+
+func TestApplyRuleDryRun(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 3)...)
+	e.sync(services.SyncOptions{})
+
+	w := e.do(http.MethodPost, "/rules", `{"name": "first", "enabled": false, "match": {"pattern": "^tweet 1$"}, "actions": {"tags": ["first"]}}`)
+	expectStatus(t, w, http.StatusCreated)
+	var rule models.Rule
+	decode(t, w, &rule)
+
+	tags := func() []string {
+		w := e.do(http.MethodGet, "/bookmarks/1", "")
+		expectStatus(t, w, http.StatusOK)
+
+		var bookmark models.Bookmark
+		decode(t, w, &bookmark)
+
+		return bookmark.Tags
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		target := "/rules/" + strconv.FormatInt(rule.ID, 10) + "/apply"
+		if dryRun {
+			target += "?dry_run=true"
+		}
+
+		w := e.do(http.MethodPost, target, "")
+		expectStatus(t, w, http.StatusOK)
+
+		var response struct {
+			DryRun  bool                 `json:"dry_run"`
+			Matches []models.RuleMatches `json:"matches"`
+		}
+		decode(t, w, &response)
+
+		want := []models.RuleMatches{{RuleID: rule.ID, TweetIDs: []string{"1"}}}
+		if response.DryRun != dryRun || !reflect.DeepEqual(response.Matches, want) {
+			t.Errorf("dry run %t: response = %+v, want %+v", dryRun, response, want)
+		}
+
+		wantTags := []string{"first"}
+		if dryRun {
+			wantTags = nil
+		}
+		if got := tags(); !reflect.DeepEqual(got, wantTags) {
+			t.Errorf("dry run %t: tags = %v, want %v", dryRun, got, wantTags)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/services"
+	"twitter-bookmarks/store"
+)
+
+func (s *Server) searchBookmarks(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := c.Query("q")
+		if q == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing search query q"})
+			return
+		}
+
+		filter, err := bookmarkFilter(c, store.AllBookmarks)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		query, err := store.ParseSearchQuery(q, filter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		response, err := archive.SearchBookmarks(c.Request.Context(), c.GetString(userIDKey), query)
+		if err != nil {
+			respondError(c, err, "Failed to search bookmarks")
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// offsetPage reads the page of archived results requested with the limit and cursor query
+// parameters, the cursor being the offset of the page
+func offsetPage(c *gin.Context, defaultLimit int) (limit, offset int, err error) {
+	limit = defaultLimit
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > services.MaxPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", services.MaxPageSize)
+		}
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		offset, err = strconv.Atoi(cursor)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid cursor")
+		}
+	}
+
+	return limit, offset, nil
+}
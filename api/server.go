@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -16,6 +17,9 @@ type Options func(*Server)
 type Server struct {
 	httpServer *http.Server
 	handler    *gin.Engine
+	media      mediaFiles
+	publicURL  string
+	now        func() time.Time
 }
 
 // New creates a new Server instance.
@@ -29,6 +33,7 @@ func New(port string, options ...Options) *Server {
 			Addr: fmt.Sprintf("0.0.0.0:%s", port),
 		},
 		handler: handler,
+		now:     time.Now,
 	}
 
 	for _, o := range options {
@@ -50,13 +55,67 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.httpServer.Shutdown(ctx)
 }
 
-// WithRegisterRoutes register the routes for the server.
-func WithRegisterRoutes(service service, secretKey string, codeVerifier string) Options {
+// WithClock sets the function telling the current time, used to date the changes made to the archive
+func WithClock(now func() time.Time) Options {
 	return func(s *Server) {
-		s.handler.Use(middleware.Auth(secretKey))
+		s.now = now
+	}
+}
+
+// WithRegisterRoutes register the routes for the server, apiKeys maps each API key to the Twitter user IDs it may read.
+func WithRegisterRoutes(service service, archive archive, scheduler scheduler, jobs syncJobs, threads threads, apiKeys map[string][]string) Options {
+	return func(s *Server) {
+		logins := newLoginStore(loginTTL)
+
+		auth := s.handler.Group("/auth")
+		auth.GET("/login", s.login(service, logins))
+		auth.GET("/callback", s.callback(service, logins))
 
-		s.handler.GET("/authenticate", s.authenticate(service, codeVerifier))
-		s.handler.GET("/bookmarks", s.getBookmarks(service))
-		s.handler.GET("/bookmarks/filter", s.getBookmarksWithDateFilter(service))
+		authorized := s.handler.Group("/", middleware.Auth(apiKeys))
+		authorized.GET("/users", s.listUsers(service))
+
+		users := authorized.Group("/users/:id", s.account(service))
+		users.DELETE("", s.revoke(service, archive))
+		s.registerAccountRoutes(users, service, archive, scheduler, jobs, threads)
+
+		// the same routes without the /users/{id} prefix read the only account available to the API key
+		s.registerAccountRoutes(authorized.Group("", s.account(service)), service, archive, scheduler, jobs, threads)
 	}
 }
+
+// registerAccountRoutes register the routes reading a single Twitter account.
+func (s *Server) registerAccountRoutes(g *gin.RouterGroup, service service, archive archive, scheduler scheduler, jobs syncJobs, threads threads) {
+	g.GET("/me", s.getMe(service))
+	g.GET("/status/ratelimit", s.getRateLimits(service))
+	g.GET("/status/sync", s.getSyncStatus(scheduler))
+	g.POST("/sync", s.startSync(jobs))
+	g.GET("/sync/:job", s.getSyncJob(jobs))
+	g.GET("/bookmarks", s.getBookmarks(archive))
+	g.GET("/bookmarks/history", s.getHistory(archive))
+	g.GET("/bookmarks/search", s.searchBookmarks(archive))
+	g.GET("/bookmarks/export", s.exportBookmarks(archive))
+	g.GET("/bookmarks/:tweet", s.getBookmark(archive))
+	g.PATCH("/bookmarks/:tweet", s.annotateBookmark(archive))
+	g.GET("/bookmarks/:tweet/thread", s.getThread(archive, threads))
+	g.PUT("/bookmarks/:tweet/tags", s.setTags(archive))
+	g.DELETE("/bookmarks/:tweet/tags", s.removeTags(archive))
+	g.GET("/tags", s.listTags(archive))
+	g.PATCH("/tags/:tag", s.renameTag(archive))
+	g.POST("/tags/merge", s.mergeTags(archive))
+	g.GET("/collections", s.listCollections(archive))
+	g.POST("/collections", s.createCollection(archive))
+	g.GET("/collections/:collection", s.getCollection(archive))
+	g.PATCH("/collections/:collection", s.updateCollection(archive))
+	g.DELETE("/collections/:collection", s.deleteCollection(archive))
+	g.GET("/collections/:collection/bookmarks", s.getCollectionBookmarks(archive))
+	g.POST("/collections/:collection/bookmarks", s.addToCollection(archive))
+	g.PATCH("/collections/:collection/bookmarks/:tweet", s.moveInCollection(archive))
+	g.DELETE("/collections/:collection/bookmarks/:tweet", s.removeFromCollection(archive))
+	g.GET("/rules", s.listRules(archive))
+	g.POST("/rules", s.createRule(archive))
+	g.POST("/rules/apply", s.applyRules(archive))
+	g.GET("/rules/:rule", s.getRule(archive))
+	g.PUT("/rules/:rule", s.updateRule(archive))
+	g.DELETE("/rules/:rule", s.deleteRule(archive))
+	g.POST("/rules/:rule/apply", s.applyRule(archive))
+}
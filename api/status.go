@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/services"
+)
+
+func (s *Server) getRateLimits(service service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"rate_limits": service.RateLimits(c.GetString(userIDKey))})
+	}
+}
+
+// scheduler reports the state of the background sync
+type scheduler interface {
+	SyncStatus(userID string) services.SyncStatus
+}
+
+func (s *Server) getSyncStatus(scheduler scheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, scheduler.SyncStatus(c.GetString(userIDKey)))
+	}
+}
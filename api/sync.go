@@ -0,0 +1,44 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/services"
+)
+
+// syncJobs runs the syncs requested through the API
+type syncJobs interface {
+	Enqueue(userID string, full, expandThreads bool) (services.SyncJob, error)
+	Job(id string) (services.SyncJob, error)
+}
+
+func (s *Server) startSync(jobs syncJobs) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := jobs.Enqueue(c.GetString(userIDKey), c.Query("full") == "true", c.Query("expand_threads") == "true")
+		if err != nil {
+			respondError(c, err, "Failed to start sync")
+			return
+		}
+
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+func (s *Server) getSyncJob(jobs syncJobs) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := jobs.Job(c.Param("job"))
+		if errors.Is(err, services.ErrSyncJobNotFound) || err == nil && job.UserID != c.GetString(userIDKey) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown sync job"})
+			return
+		}
+		if err != nil {
+			respondError(c, err, "Failed to fetch sync job")
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
+	}
+}
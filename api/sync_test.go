@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/services"
+	"twitter-bookmarks/services/twittertest"
+)
+
+// startSync requests a sync and returns its job
+func (e *testEnv) startSync(query string) services.SyncJob {
+	e.t.Helper()
+
+	w := e.do(http.MethodPost, "/sync"+query, "")
+	expectStatus(e.t, w, http.StatusAccepted)
+
+	var job services.SyncJob
+	decode(e.t, w, &job)
+
+	return job
+}
+
+// runJobs runs the sync jobs until the test ends
+func (e *testEnv) runJobs() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.jobs.Run(ctx)
+	}()
+
+	e.t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitJob polls a sync job until it finishes
+func (e *testEnv) waitJob(id string) services.SyncJob {
+	e.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := e.do(http.MethodGet, "/sync/"+id, "")
+		expectStatus(e.t, w, http.StatusOK)
+
+		var job services.SyncJob
+		decode(e.t, w, &job)
+		if job.FinishedAt != nil {
+			return job
+		}
+		if time.Now().After(deadline) {
+			e.t.Fatalf("job %s still %s", id, job.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartSyncSameJob(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 10)...)
+
+	first := e.startSync("")
+	second := e.startSync("?full=true")
+	if second.ID != first.ID {
+		t.Errorf("second sync job %s, want %s", second.ID, first.ID)
+	}
+	if !second.Full {
+		t.Error("queued job not upgraded to a full sync")
+	}
+
+	e.runJobs()
+
+	job := e.waitJob(first.ID)
+	if job.State != services.SyncSucceeded || job.Added != 10 {
+		t.Errorf("job = %+v, want 10 bookmarks added", job)
+	}
+}
+
+func TestStartSyncFailed(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.FailNext(twittertest.BookmarksEndpoint, http.StatusServiceUnavailable, 4)
+
+	queued := e.startSync("")
+	e.runJobs()
+
+	job := e.waitJob(queued.ID)
+	if job.State != services.SyncFailed || job.Error == "" {
+		t.Errorf("job = %+v, want failed with its error", job)
+	}
+}
+
+func TestGetSyncJobNotFound(t *testing.T) {
+	e := newTestEnv(t)
+
+	expectStatus(t, e.do(http.MethodGet, "/sync/unknown", ""), http.StatusNotFound)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) setTags(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body, expected {\"tags\": [...]}"})
+			return
+		}
+
+		userID, tweetID := c.GetString(userIDKey), c.Param("tweet")
+		if err := archive.SetTags(c.Request.Context(), userID, tweetID, body.Tags, s.now()); err != nil {
+			respondArchiveError(c, err, "Failed to tag bookmark")
+			return
+		}
+
+		s.respondBookmark(c, archive, userID, tweetID)
+	}
+}
+
+func (s *Server) removeTags(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, tweetID := c.GetString(userIDKey), c.Param("tweet")
+		if err := archive.RemoveTags(c.Request.Context(), userID, tweetID, listQuery(c, "tag")); err != nil {
+			respondArchiveError(c, err, "Failed to untag bookmark")
+			return
+		}
+
+		s.respondBookmark(c, archive, userID, tweetID)
+	}
+}
+
+func (s *Server) listTags(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tags, err := archive.ListTags(c.Request.Context(), c.GetString(userIDKey))
+		if err != nil {
+			respondError(c, err, "Failed to fetch tags")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"tags": tags})
+	}
+}
+
+func (s *Server) renameTag(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Name string `json:"name" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body, expected {\"name\": \"...\"}"})
+			return
+		}
+
+		s.mergeTagsInto(c, archive, []string{c.Param("tag")}, body.Name)
+	}
+}
+
+func (s *Server) mergeTags(archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Tags []string `json:"tags" binding:"required"`
+			Into string   `json:"into" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body, expected {\"tags\": [...], \"into\": \"...\"}"})
+			return
+		}
+
+		s.mergeTagsInto(c, archive, body.Tags, body.Into)
+	}
+}
+
+func (s *Server) mergeTagsInto(c *gin.Context, archive archive, from []string, to string) {
+	relabeled, err := archive.MergeTags(c.Request.Context(), c.GetString(userIDKey), from, to)
+	if err != nil {
+		respondArchiveError(c, err, "Failed to merge tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"relabeled": relabeled})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/store"
+)
+
+// threads expands the threads of bookmarked tweets from Twitter
+type threads interface {
+	ExpandThread(ctx context.Context, userID string, bookmark models.Bookmark) (*models.Thread, error)
+}
+
+// getThread returns the archived thread of a bookmark, it is expanded from Twitter when it was never
+// archived or with ?refresh=true
+func (s *Server) getThread(archive archive, threads threads) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString(userIDKey)
+
+		bookmark, err := archive.GetBookmark(c.Request.Context(), userID, c.Param("tweet"))
+		if err != nil {
+			respondArchiveError(c, err, "Failed to fetch bookmark")
+			return
+		}
+
+		if c.Query("refresh") != "true" {
+			thread, err := archive.ThreadOf(c.Request.Context(), userID, bookmark.TweetID)
+			if err == nil {
+				c.JSON(http.StatusOK, thread)
+				return
+			}
+			if !errors.Is(err, store.ErrNotFound) {
+				respondError(c, err, "Failed to fetch thread")
+				return
+			}
+		}
+
+		thread, err := threads.ExpandThread(c.Request.Context(), userID, *bookmark)
+		if err != nil {
+			respondError(c, err, "Failed to expand thread")
+			return
+		}
+
+		c.JSON(http.StatusOK, thread)
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"twitter-bookmarks/api/middleware"
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services"
+)
+
+// userIDKey is the key for the Twitter user ID the request reads in the context
+const userIDKey = "TWITTER_USER_ID"
+
+// account is a middleware resolving the account a request reads. The account comes from the :id
+// path parameter, or when absent, is the only connected account the API key may read.
+func (s *Server) account(service service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("id")
+		if userID == "" {
+			users, err := s.readableUsers(c, service)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "Failed to fetch accounts",
+					"details": err.Error(),
+				})
+				c.Abort()
+				return
+			}
+
+			switch len(users) {
+			case 0:
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "No Twitter account connected, visit /auth/login"})
+				c.Abort()
+				return
+			case 1:
+				userID = users[0].ID
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Several accounts are available, use /users/{id}" + c.Request.URL.Path})
+				c.Abort()
+				return
+			}
+		}
+
+		if !middleware.CanRead(c, userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			c.Abort()
+			return
+		}
+
+		if _, err := service.User(c.Request.Context(), userID); err != nil {
+			if errors.Is(err, services.ErrNotAuthenticated) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Unknown account"})
+				c.Abort()
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to fetch account",
+				"details": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set(userIDKey, userID)
+		c.Next()
+	}
+}
+
+func (s *Server) readableUsers(c *gin.Context, service service) ([]models.User, error) {
+	users, err := service.Users(c.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	readable := make([]models.User, 0, len(users))
+	for _, user := range users {
+		if middleware.CanRead(c, user.ID) {
+			readable = append(readable, user)
+		}
+	}
+
+	return readable, nil
+}
+
+func (s *Server) listUsers(service service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		users, err := s.readableUsers(c, service)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to fetch accounts",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"users": users})
+	}
+}
+
+// revoke disconnects an account and removes its archive
+func (s *Server) revoke(service service, archive archive) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString(userIDKey)
+		if err := service.Revoke(c.Request.Context(), userID); err != nil {
+			respondError(c, err, "Failed to revoke token")
+			return
+		}
+
+		if err := archive.DeleteArchive(c.Request.Context(), userID); err != nil {
+			respondError(c, err, "Failed to delete archive")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+	}
+}
+
+func (s *Server) getMe(service service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		refresh := c.Query("refresh") == "true"
+
+		user, err := service.Me(c.Request.Context(), c.GetString(userIDKey), refresh)
+		if err != nil {
+			respondError(c, err, "Failed to fetch profile")
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
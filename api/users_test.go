@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services"
+	"twitter-bookmarks/services/twittertest"
+	"twitter-bookmarks/store"
+)
+
+func TestGetMeExpiredToken(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.ExpireTokens()
+
+	w := e.do(http.MethodGet, "/me?refresh=true", "")
+	expectStatus(t, w, http.StatusOK)
+
+	var user models.User
+	decode(t, w, &user)
+	if user.ID != testUserID {
+		t.Errorf("profile of %q, want %q", user.ID, testUserID)
+	}
+
+	var refreshes int
+	for _, r := range e.fake.Requests() {
+		if r.Endpoint == twittertest.TokenEndpoint {
+			refreshes++
+		}
+	}
+	if refreshes != 1 {
+		t.Errorf("refreshed %d times, want 1", refreshes)
+	}
+}
+
+func TestGetMeRateLimited(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.RateLimit = 10
+	e.fake.FailNext(twittertest.MeEndpoint, http.StatusTooManyRequests, 1)
+
+	w := e.do(http.MethodGet, "/me?refresh=true", "")
+	expectStatus(t, w, http.StatusTooManyRequests)
+	if w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("Content-Type = %q, want a problem", w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("Retry-After") == "" || w.Header().Get("Retry-After") == "0" {
+		t.Errorf("Retry-After = %q, want the rate limit reset", w.Header().Get("Retry-After"))
+	}
+
+	w = e.do(http.MethodGet, "/status/ratelimit", "")
+	expectStatus(t, w, http.StatusOK)
+
+	var body struct {
+		RateLimits []services.EndpointRateLimit `json:"rate_limits"`
+	}
+	decode(t, w, &body)
+	if len(body.RateLimits) != 1 || body.RateLimits[0].Limit != 10 || body.RateLimits[0].Remaining != 9 {
+		t.Errorf("rate limits = %+v, want the /2/users/me rate limit", body.RateLimits)
+	}
+}
+
+func TestGetMeUpstreamError(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.FailNext(twittertest.MeEndpoint, http.StatusServiceUnavailable, 4)
+
+	w := e.do(http.MethodGet, "/me?refresh=true", "")
+	expectStatus(t, w, http.StatusBadGateway)
+}
+
+func TestRevoke(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("revoked", func(t *testing.T) {
+		e := newTestEnv(t)
+		e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 3)...)
+		e.sync(services.SyncOptions{})
+		expectStatus(t, e.do(http.MethodPut, "/bookmarks/1/tags", `{"tags":["go"]}`), http.StatusOK)
+
+		expectStatus(t, e.do(http.MethodDelete, "/users/"+testUserID, ""), http.StatusOK)
+
+		if _, err := e.store.GetUser(ctx, testUserID); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("GetUser err = %v, want the account removed", err)
+		}
+		if _, err := e.store.GetBookmark(ctx, testUserID, "1"); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("GetBookmark err = %v, want the archive removed", err)
+		}
+		tags, err := e.store.ListTags(ctx, testUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 0 {
+			t.Errorf("tags = %v, want the tags removed", tags)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		e := newTestEnv(t)
+		e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 3)...)
+		e.sync(services.SyncOptions{})
+		e.fake.FailNext(twittertest.RevokeEndpoint, http.StatusServiceUnavailable, 1)
+
+		expectStatus(t, e.do(http.MethodDelete, "/users/"+testUserID, ""), http.StatusBadGateway)
+
+		if _, err := e.store.GetUser(ctx, testUserID); err != nil {
+			t.Errorf("GetUser err = %v, want the account kept", err)
+		}
+		if _, err := e.store.GetBookmark(ctx, testUserID, "1"); err != nil {
+			t.Errorf("GetBookmark err = %v, want the archive kept", err)
+		}
+	})
+}
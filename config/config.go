@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -10,17 +12,65 @@ import (
 
 // Config is the configuration for the application
 type Config struct {
-	TwitterConsumerKey    string `envconfig:"TWITTER_CONSUMER_KEY"`
-	TwitterConsumerSecret string `envconfig:"TWITTER_CONSUMER_SECRET"`
-	TwitterAccessToken    string `envconfig:"TWITTER_ACCESS_TOKEN"`
-	TwitterAccessSecret   string `envconfig:"TWITTER_ACCESS_SECRET"`
-	TwitterUserID         string `envconfig:"TWITTER_USER_ID"`
-	SecretKey             string `envconfig:"SECRET_KEY"`
-	TwitterClientID       string `envconfig:"TWITTER_CLIENT_ID"`
-	TwitterClientSecret   string `envconfig:"TWITTER_CLIENT_SECRET"`
-	TwitterAuthToken      string `envconfig:"TWITTER_AUTH_TOKEN"`
-	TwitterRedirectURI    string `envconfig:"TWITTER_REDIRECT_URI"`
-	Port                  string `envconfig:"PORT" default:"8080"`
+	TwitterConsumerKey    string  `envconfig:"TWITTER_CONSUMER_KEY"`
+	TwitterConsumerSecret string  `envconfig:"TWITTER_CONSUMER_SECRET"`
+	TwitterAccessToken    string  `envconfig:"TWITTER_ACCESS_TOKEN"`
+	TwitterAccessSecret   string  `envconfig:"TWITTER_ACCESS_SECRET"`
+	TwitterUserID         string  `envconfig:"TWITTER_USER_ID"`
+	SecretKey             string  `envconfig:"SECRET_KEY"`
+	APIKeys               APIKeys `envconfig:"API_KEYS"`
+	TwitterClientID       string  `envconfig:"TWITTER_CLIENT_ID"`
+	TwitterClientSecret   string  `envconfig:"TWITTER_CLIENT_SECRET"`
+	TwitterRedirectURI    string  `envconfig:"TWITTER_REDIRECT_URI"`
+	TwitterBaseURL        string  `envconfig:"TWITTER_BASE_URL" default:"https://api.twitter.com"`
+	TwitterAuthBaseURL    string  `envconfig:"TWITTER_AUTH_BASE_URL" default:"https://twitter.com"`
+	AccountStore          string  `envconfig:"ACCOUNT_STORE" default:"file"`
+	AccountsFile          string  `envconfig:"ACCOUNTS_FILE" default:"accounts.json"`
+	DatabasePath          string  `envconfig:"DATABASE_PATH" default:"twitter-bookmarks.db"`
+	Port                  string  `envconfig:"PORT" default:"8080"`
+	// SyncInterval is the delay between two background syncs of an account, 0 disables the background sync
+	SyncInterval     time.Duration `envconfig:"SYNC_INTERVAL" default:"15m"`
+	SyncJitter       time.Duration `envconfig:"SYNC_JITTER" default:"1m"`
+	SyncFullInterval time.Duration `envconfig:"SYNC_FULL_INTERVAL" default:"24h"`
+	SyncMaxPages     int           `envconfig:"SYNC_MAX_PAGES" default:"0"`
+	// SyncExpandThreads archives the thread of each new bookmark during the background syncs
+	SyncExpandThreads bool `envconfig:"SYNC_EXPAND_THREADS" default:"false"`
+	// MediaDir is the directory mirroring the media of the archived bookmarks, empty disables the mirroring
+	MediaDir      string        `envconfig:"MEDIA_DIR"`
+	MediaInterval time.Duration `envconfig:"MEDIA_INTERVAL" default:"10m"`
+	MediaMaxSize  int64         `envconfig:"MEDIA_MAX_SIZE" default:"104857600"`
+	// PublicURL is the URL the server is reached at, the exports link to the mirrored media under it.
+	// It defaults to http://localhost on Port.
+	PublicURL string `envconfig:"PUBLIC_URL"`
+}
+
+// AllAccounts grants an API key access to every connected account
+const AllAccounts = "*"
+
+// APIKeys maps each API key to the Twitter user IDs it may read
+type APIKeys map[string][]string
+
+// Decode parses API keys formatted as key1:userID1|userID2,key2:*
+func (k *APIKeys) Decode(value string) error {
+	keys := make(APIKeys)
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, accounts, ok := strings.Cut(entry, ":")
+		if !ok || key == "" || accounts == "" {
+			return fmt.Errorf("invalid API key entry %q, expected key:userID1|userID2", entry)
+		}
+
+		keys[key] = append(keys[key], strings.Split(accounts, "|")...)
+	}
+
+	*k = keys
+
+	return nil
 }
 
 // Load loads the configuration from the environment variables
@@ -36,5 +86,18 @@ func Load() (Config, error) {
 		return Config{}, fmt.Errorf("unable to get envconfig %w", err)
 	}
 
+	if c.APIKeys == nil {
+		c.APIKeys = make(APIKeys)
+	}
+
+	if c.PublicURL == "" {
+		c.PublicURL = "http://localhost:" + c.Port
+	}
+	c.PublicURL = strings.TrimSuffix(c.PublicURL, "/")
+
+	if c.SecretKey != "" {
+		c.APIKeys[c.SecretKey] = []string{AllAccounts}
+	}
+
 	return c, nil
 }
@@ -3,15 +3,19 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"twitter-bookmarks/api"
 	"twitter-bookmarks/config"
 	"twitter-bookmarks/services"
+	"twitter-bookmarks/store"
 )
 
 func main() {
@@ -22,8 +26,55 @@ func main() {
 
 	ctx := context.Background()
 
-	twitterService := services.NewTwitterService(cfg.TwitterClientID, cfg.TwitterClientSecret, cfg.TwitterRedirectURI)
-	srv := api.New(cfg.Port, api.WithRegisterRoutes(twitterService, cfg.SecretKey, cfg.TwitterAuthToken))
+	db, err := store.OpenSQLite(cfg.DatabasePath)
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	archive, err := store.NewSQLiteStore(ctx, db)
+	if err != nil {
+		log.Fatalf("failed to create bookmark store: %v", err)
+	}
+
+	accounts, err := newAccountStore(cfg, archive)
+	if err != nil {
+		log.Fatalf("failed to create account store: %v", err)
+	}
+
+	// every service tells the time with the same clock
+	now := time.Now
+
+	twitterService := services.NewTwitterService(cfg.TwitterClientID, cfg.TwitterClientSecret, cfg.TwitterRedirectURI, accounts,
+		services.WithBaseURL(cfg.TwitterBaseURL),
+		services.WithAuthBaseURL(cfg.TwitterAuthBaseURL),
+		services.WithClock(now),
+	)
+	syncer := services.NewSyncer(twitterService, archive, archive, archive)
+	syncJobs := services.NewSyncJobs(syncer)
+	scheduler := services.NewScheduler(syncer, services.SchedulerConfig{
+		Interval:      cfg.SyncInterval,
+		Jitter:        cfg.SyncJitter,
+		FullInterval:  cfg.SyncFullInterval,
+		MaxPages:      cfg.SyncMaxPages,
+		ExpandThreads: cfg.SyncExpandThreads,
+	})
+	options := []api.Options{
+		api.WithClock(now),
+		api.WithRegisterRoutes(twitterService, archive, scheduler, syncJobs, syncer, cfg.APIKeys),
+	}
+
+	var mirror *services.MediaMirror
+	if cfg.MediaDir != "" {
+		mirror = services.NewMediaMirror(archive, services.MediaMirrorConfig{
+			Dir:      cfg.MediaDir,
+			Interval: cfg.MediaInterval,
+			MaxSize:  cfg.MediaMaxSize,
+			Now:      now,
+		})
+		options = append(options, api.WithMedia(mirror, cfg.PublicURL))
+	}
+	srv := api.New(cfg.Port, options...)
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
@@ -37,13 +88,49 @@ func main() {
 		}
 	}()
 
+	syncCtx, stopSync := context.WithCancel(ctx)
+	var syncing sync.WaitGroup
+	syncing.Add(2)
+	go func() {
+		defer syncing.Done()
+		syncJobs.Run(syncCtx)
+	}()
+	go func() {
+		defer syncing.Done()
+		if cfg.SyncInterval > 0 {
+			scheduler.Run(syncCtx)
+		}
+	}()
+	if mirror != nil {
+		syncing.Add(1)
+		go func() {
+			defer syncing.Done()
+			mirror.Run(syncCtx)
+		}()
+	}
+
 	<-quit
 
 	log.Println("shutting down server...")
 
+	stopSync()
+	syncing.Wait()
+
 	if err := srv.Shutdown(ctx); err != nil {
 		panic(err)
 	}
 
 	log.Println("server shutdown")
 }
+
+// newAccountStore returns the store configured for the accounts, the sqlite store shares the bookmark database
+func newAccountStore(cfg config.Config, db *store.SQLiteStore) (store.AccountStore, error) {
+	switch cfg.AccountStore {
+	case "file":
+		return store.NewFileStore(cfg.AccountsFile), nil
+	case "sqlite":
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown account store %q", cfg.AccountStore)
+	}
+}
@@ -3,20 +3,207 @@ package models
 import "time"
 
 type Bookmark struct {
-    ID        string    `json:"id"`
-    TweetID   string    `json:"tweet_id"`
-    Text      string    `json:"text"`
-    CreatedAt time.Time `json:"created_at"`
-    Author    Author    `json:"author"`
+	ID             string       `json:"id"`
+	TweetID        string       `json:"tweet_id"`
+	Text           string       `json:"text"`
+	CreatedAt      time.Time    `json:"created_at"`
+	Lang           string       `json:"lang,omitempty"`
+	ConversationID string       `json:"conversation_id,omitempty"`
+	Author         Author       `json:"author"`
+	PublicMetrics  TweetMetrics `json:"public_metrics"`
+	Entities       Entities     `json:"entities"`
+	Attachments    Attachments  `json:"attachments"`
+	// Media are the media attached to the tweet, in the order of Attachments.MediaKeys
+	Media []Media `json:"media,omitempty"`
+	// ReferencedTweets lists the tweets quoted, replied to or retweeted by the tweet, QuotedTweet,
+	// InReplyTo and RetweetOf hold those Twitter returned
+	ReferencedTweets []ReferencedTweet `json:"referenced_tweets,omitempty"`
+	QuotedTweet      *Tweet            `json:"quoted_tweet,omitempty"`
+	InReplyTo        *Tweet            `json:"in_reply_to,omitempty"`
+	RetweetOf        *Tweet            `json:"retweet_of,omitempty"`
+	// FirstSeenAt and LastSeenAt are when the bookmark was first and last fetched from Twitter,
+	// they are only set on archived bookmarks
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	// Bookmarked tells whether the tweet is still bookmarked on Twitter, RemovedAt is when an
+	// archived bookmark was found missing from the bookmarks of the account
+	Bookmarked bool       `json:"bookmarked"`
+	RemovedAt  *time.Time `json:"removed_at,omitempty"`
+	// Tags are the labels given to an archived bookmark
+	Tags []string `json:"tags,omitempty"`
+	// Note is a markdown note written on an archived bookmark, Highlights are the spans of its
+	// text marked as important and AnnotatedAt is when they were last changed
+	Note        string      `json:"note,omitempty"`
+	Highlights  []Highlight `json:"highlights,omitempty"`
+	AnnotatedAt *time.Time  `json:"annotated_at,omitempty"`
+}
+
+// Highlight is a span of a tweet text, Start and End are rune offsets in the text
+type Highlight struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text"`
+}
+
+// Types of ReferencedTweet
+const (
+	ReferenceQuoted    = "quoted"
+	ReferenceRepliedTo = "replied_to"
+	ReferenceRetweeted = "retweeted"
+)
+
+// ReferencedTweet is a tweet quoted, replied to or retweeted by another tweet
+type ReferencedTweet struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Tweet is a tweet referenced by a bookmark, the tweets it references in turn are only listed
+type Tweet struct {
+	ID               string            `json:"id"`
+	Text             string            `json:"text"`
+	CreatedAt        time.Time         `json:"created_at"`
+	Lang             string            `json:"lang,omitempty"`
+	ConversationID   string            `json:"conversation_id,omitempty"`
+	Author           Author            `json:"author"`
+	PublicMetrics    TweetMetrics      `json:"public_metrics"`
+	Entities         Entities          `json:"entities"`
+	Attachments      Attachments       `json:"attachments"`
+	Media            []Media           `json:"media,omitempty"`
+	ReferencedTweets []ReferencedTweet `json:"referenced_tweets,omitempty"`
 }
 
 type Author struct {
-    ID       string `json:"id"`
-    Username string `json:"username"`
-    Name     string `json:"name"`
+	ID              string `json:"id"`
+	Username        string `json:"username"`
+	Name            string `json:"name"`
+	ProfileImageURL string `json:"profile_image_url,omitempty"`
+	Verified        bool   `json:"verified"`
+}
+
+// TweetMetrics are the public engagement counters of a tweet
+type TweetMetrics struct {
+	RetweetCount    int `json:"retweet_count"`
+	ReplyCount      int `json:"reply_count"`
+	LikeCount       int `json:"like_count"`
+	QuoteCount      int `json:"quote_count"`
+	BookmarkCount   int `json:"bookmark_count"`
+	ImpressionCount int `json:"impression_count"`
+}
+
+// Entities are the parts of a tweet text Twitter parsed, Start and End are rune offsets in the text
+type Entities struct {
+	URLs     []URLEntity     `json:"urls,omitempty"`
+	Hashtags []HashtagEntity `json:"hashtags,omitempty"`
+	Mentions []MentionEntity `json:"mentions,omitempty"`
+	Cashtags []CashtagEntity `json:"cashtags,omitempty"`
+}
+
+// URLEntity is a link of a tweet, the t.co URL redirects to ExpandedURL which redirects to
+// UnwoundURL when Twitter followed the redirects. Title and Description describe the linked page.
+type URLEntity struct {
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	URL         string `json:"url"`
+	ExpandedURL string `json:"expanded_url"`
+	DisplayURL  string `json:"display_url"`
+	UnwoundURL  string `json:"unwound_url,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// MediaKey is set when the link points to media attached to the tweet
+	MediaKey string `json:"media_key,omitempty"`
+}
+
+type HashtagEntity struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Tag   string `json:"tag"`
+}
+
+// MentionEntity is a mentioned account, ID is empty when Twitter could not resolve the username
+type MentionEntity struct {
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Username string `json:"username"`
+	ID       string `json:"id,omitempty"`
+}
+
+// CashtagEntity is a $TICKER symbol, Tag holds the symbol without the dollar sign
+type CashtagEntity struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Tag   string `json:"tag"`
+}
+
+// Attachments reference the media and polls attached to a tweet
+type Attachments struct {
+	MediaKeys []string `json:"media_keys,omitempty"`
+	PollIDs   []string `json:"poll_ids,omitempty"`
+}
+
+// Media is a photo, video or animated GIF attached to a tweet. URL is only set for photos, videos
+// and GIFs are played from their Variants.
+type Media struct {
+	MediaKey        string         `json:"media_key"`
+	Type            string         `json:"type"`
+	URL             string         `json:"url,omitempty"`
+	PreviewImageURL string         `json:"preview_image_url,omitempty"`
+	Width           int            `json:"width,omitempty"`
+	Height          int            `json:"height,omitempty"`
+	DurationMS      int            `json:"duration_ms,omitempty"`
+	AltText         string         `json:"alt_text,omitempty"`
+	Variants        []MediaVariant `json:"variants,omitempty"`
+}
+
+// MediaVariant is an encoding of a video or animated GIF
+type MediaVariant struct {
+	BitRate     int    `json:"bit_rate,omitempty"`
+	ContentType string `json:"content_type"`
+	URL         string `json:"url"`
 }
 
 type BookmarkResponse struct {
-    Bookmarks []Bookmark `json:"bookmarks"`
-    NextToken string     `json:"next_token,omitempty"`
+	Bookmarks  []Bookmark `json:"bookmarks"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// SearchResult is an archived bookmark matching a search, Snippet is the part of its text
+// around the matches, highlighted with <mark> tags
+type SearchResult struct {
+	Bookmark Bookmark `json:"bookmark"`
+	Score    float64  `json:"score"`
+	Snippet  string   `json:"snippet"`
+}
+
+type SearchResponse struct {
+	Results    []SearchResult `json:"results"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// Tag is a label given to archived bookmarks, Count is the number of bookmarks it labels
+type Tag struct {
+	Name  string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// BookmarkEventType is the kind of change recorded in the bookmark history
+type BookmarkEventType string
+
+const (
+	BookmarkAdded   BookmarkEventType = "added"
+	BookmarkRemoved BookmarkEventType = "removed"
+)
+
+// BookmarkEvent is a tweet added to or removed from the bookmarks of an account
+type BookmarkEvent struct {
+	Type       BookmarkEventType `json:"type"`
+	TweetID    string            `json:"tweet_id"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	Bookmark   *Bookmark         `json:"bookmark,omitempty"`
+}
+
+// HistoryResponse is a page of the bookmark history, NextCursor is empty on the last page
+type HistoryResponse struct {
+	Events     []BookmarkEvent `json:"events"`
+	NextCursor string          `json:"next_cursor,omitempty"`
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Collection is a named, ordered list of archived bookmarks, a bookmark may belong to many collections
+type Collection struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Position    int       `json:"position"`
+	Count       int       `json:"count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
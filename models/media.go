@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// MediaFile is a media file mirrored from Twitter to a local file, Hash is the hex SHA-256 of its
+// content. Hash is empty and Error holds the last failure until the download succeeds.
+type MediaFile struct {
+	URL        string    `json:"url"`
+	Hash       string    `json:"hash"`
+	MIMEType   string    `json:"mime_type"`
+	Size       int64     `json:"size"`
+	Attempts   int       `json:"attempts"`
+	Error      string    `json:"error,omitempty"`
+	MirroredAt time.Time `json:"mirrored_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Rule tags or collects the bookmarks matching its conditions as they are archived
+type Rule struct {
+	ID        int64          `json:"id"`
+	Name      string         `json:"name"`
+	Enabled   bool           `json:"enabled"`
+	Match     RuleConditions `json:"match"`
+	Actions   RuleActions    `json:"actions"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// RuleConditions select bookmarks, a bookmark must satisfy every condition set and matches a
+// condition listing several values when it matches any of them
+type RuleConditions struct {
+	// Authors are usernames, compared case insensitively
+	Authors []string `json:"authors,omitempty"`
+	// Keywords are matched case insensitively anywhere in the text
+	Keywords []string `json:"keywords,omitempty"`
+	// Pattern is a regular expression matched against the text
+	Pattern string `json:"pattern,omitempty"`
+	// Domains match the links to these domains and their subdomains
+	Domains  []string `json:"domains,omitempty"`
+	Hashtags []string `json:"hashtags,omitempty"`
+	// MediaTypes are photo, video or animated_gif
+	MediaTypes []string `json:"media_types,omitempty"`
+}
+
+// RuleActions are applied to the bookmarks matching a rule
+type RuleActions struct {
+	Tags        []string `json:"tags,omitempty"`
+	Collections []int64  `json:"collections,omitempty"`
+}
+
+// RuleMatches are the archived bookmarks matched by a rule
+type RuleMatches struct {
+	RuleID   int64    `json:"rule_id"`
+	TweetIDs []string `json:"tweet_ids"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Thread is the tweets an author posted in a conversation, oldest first. ConversationID is the ID
+// of the tweet that started the conversation.
+type Thread struct {
+	ConversationID string    `json:"conversation_id"`
+	AuthorID       string    `json:"author_id"`
+	Tweets         []Tweet   `json:"tweets"`
+	ExpandedAt     time.Time `json:"expanded_at"`
+}
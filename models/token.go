@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Token is an OAuth2 user access token for the Twitter API
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+	Scopes       []string  `json:"scopes,omitempty"`
+}
+
+// ExpiresWithin reports whether the token is expired at now or will expire in less than d
+func (t Token) ExpiresWithin(now time.Time, d time.Duration) bool {
+	if t.Expiry.IsZero() {
+		return false
+	}
+
+	return t.Expiry.Sub(now) < d
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// User is a Twitter account connected to the application
+type User struct {
+	ID              string      `json:"id"`
+	Username        string      `json:"username"`
+	Name            string      `json:"name"`
+	Description     string      `json:"description,omitempty"`
+	ProfileImageURL string      `json:"profile_image_url,omitempty"`
+	Location        string      `json:"location,omitempty"`
+	URL             string      `json:"url,omitempty"`
+	Verified        bool        `json:"verified"`
+	Protected       bool        `json:"protected"`
+	CreatedAt       time.Time   `json:"created_at"`
+	PublicMetrics   UserMetrics `json:"public_metrics"`
+	UpdatedAt       time.Time   `json:"updated_at"`
+}
+
+// UserMetrics are the public counters of a Twitter account
+type UserMetrics struct {
+	FollowersCount int `json:"followers_count"`
+	FollowingCount int `json:"following_count"`
+	TweetCount     int `json:"tweet_count"`
+	ListedCount    int `json:"listed_count"`
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody bounds how much of an error response is read
+const maxErrorBody = 64 << 10
+
+// APIError is an error response of the Twitter API
+type APIError struct {
+	StatusCode int `json:"-"`
+	// Title, Detail and Type are the problem fields of the response
+	Title  string `json:"title,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	Type   string `json:"type,omitempty"`
+	// Errors lists the individual errors of the response
+	Errors []ErrorDetail `json:"errors,omitempty"`
+}
+
+// ErrorDetail is an item of the errors array of a Twitter API response
+type ErrorDetail struct {
+	Message   string `json:"message,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+	Value     string `json:"value,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Twitter API error: status=%d", e.StatusCode)
+
+	if e.Title != "" {
+		fmt.Fprintf(&b, ", title=%s", e.Title)
+	}
+
+	if e.Detail != "" {
+		fmt.Fprintf(&b, ", detail=%s", e.Detail)
+	}
+
+	for _, detail := range e.Errors {
+		message := detail.Message
+		if message == "" {
+			message = detail.Detail
+		}
+		if message != "" && message != e.Detail {
+			fmt.Fprintf(&b, ", error=%s", message)
+		}
+	}
+
+	return b.String()
+}
+
+// newAPIError reads the error response of the Twitter API, it understands both the
+// problem format of the v2 endpoints and the error format of the OAuth2 endpoints
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err != nil || len(body) == 0 {
+		apiErr.Title = http.StatusText(resp.StatusCode)
+		return apiErr
+	}
+
+	var errorResponse struct {
+		APIError
+		// OAuth2 endpoints report errors as {"error": "...", "error_description": "..."}
+		OAuthError       string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err := json.Unmarshal(body, &errorResponse); err != nil {
+		apiErr.Title = http.StatusText(resp.StatusCode)
+		apiErr.Detail = strings.TrimSpace(string(body))
+		return apiErr
+	}
+
+	apiErr.Title = errorResponse.Title
+	apiErr.Detail = errorResponse.Detail
+	apiErr.Type = errorResponse.Type
+	apiErr.Errors = errorResponse.Errors
+
+	if errorResponse.OAuthError != "" {
+		apiErr.Title = errorResponse.OAuthError
+		apiErr.Detail = errorResponse.ErrorDescription
+	}
+
+	if apiErr.Title == "" {
+		apiErr.Title = http.StatusText(resp.StatusCode)
+	}
+
+	return apiErr
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services/twittertest"
+	"twitter-bookmarks/store"
+)
+
+// testUserID is the account connected in the environments of newTestEnv
+const testUserID = "1"
+
+// testEnv is a TwitterService talking to a fake Twitter API, with an account already connected
+type testEnv struct {
+	fake    *twittertest.Server
+	store   *store.SQLiteStore
+	twitter *TwitterService
+}
+
+// newTestEnv creates a testEnv, failed requests are retried without waiting
+func newTestEnv(t *testing.T, options ...Options) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+
+	db, err := store.OpenSQLite(filepath.Join(t.TempDir(), "bookmarks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	archive, err := store.NewSQLiteStore(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := twittertest.NewServer()
+	t.Cleanup(fake.Close)
+
+	fake.ConnectUser(t, archive, models.User{ID: testUserID, Username: "reader", Name: "Reader"})
+
+	options = append([]Options{
+		WithBaseURL(fake.URL),
+		WithAuthBaseURL(fake.URL),
+		WithRateLimitPolicy(RateLimitPolicy{MaxWait: time.Second, MaxRetries: 3}),
+	}, options...)
+
+	return &testEnv{
+		fake:    fake,
+		store:   archive,
+		twitter: NewTwitterService("client", "", "http://localhost/auth/callback", archive, options...),
+	}
+}
+
+// requests counts the requests the fake received for endpoint
+func (e *testEnv) requests(endpoint string) int {
+	n := 0
+	for _, r := range e.fake.Requests() {
+		if r.Endpoint == endpoint {
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrSyncJobNotFound is returned when a sync job is unknown or expired
+var ErrSyncJobNotFound = errors.New("sync job not found")
+
+// syncJobTTL is how long a finished sync job is kept
+const syncJobTTL = time.Hour
+
+// SyncJobState is the progress of a sync job
+type SyncJobState string
+
+const (
+	SyncQueued    SyncJobState = "queued"
+	SyncRunning   SyncJobState = "running"
+	SyncSucceeded SyncJobState = "succeeded"
+	SyncFailed    SyncJobState = "failed"
+)
+
+// SyncJob is a sync of an account requested through the API
+type SyncJob struct {
+	ID            string       `json:"id"`
+	UserID        string       `json:"user_id"`
+	State         SyncJobState `json:"state"`
+	Full          bool         `json:"full"`
+	ExpandThreads bool         `json:"expand_threads"`
+	CreatedAt     time.Time    `json:"created_at"`
+	StartedAt     *time.Time   `json:"started_at,omitempty"`
+	FinishedAt    *time.Time   `json:"finished_at,omitempty"`
+	Pages         int          `json:"pages"`
+	Fetched       int          `json:"fetched"`
+	Added         int          `json:"added"`
+	Removed       int          `json:"removed"`
+	Matched       int          `json:"matched"`
+	Threads       int          `json:"threads"`
+	ThreadsFailed int          `json:"threads_failed"`
+	Error         string       `json:"error,omitempty"`
+}
+
+// SyncJobs runs the sync jobs one at a time in the order they were enqueued
+type SyncJobs struct {
+	syncer *Syncer
+
+	mu     sync.Mutex
+	jobs   map[string]*SyncJob
+	active map[string]*SyncJob
+	queue  []*SyncJob
+	wake   chan struct{}
+}
+
+// NewSyncJobs creates a job queue syncing accounts with syncer
+func NewSyncJobs(syncer *Syncer) *SyncJobs {
+	return &SyncJobs{
+		syncer: syncer,
+		jobs:   make(map[string]*SyncJob),
+		active: make(map[string]*SyncJob),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Enqueue queues a sync of an account. When a job of the account is already queued or running it is
+// returned instead, a queued job becomes a full sync when full is requested and expands threads
+// when expandThreads is requested.
+func (j *SyncJobs) Enqueue(userID string, full, expandThreads bool) (SyncJob, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if job, ok := j.active[userID]; ok {
+		if job.State == SyncQueued {
+			job.Full = job.Full || full
+			job.ExpandThreads = job.ExpandThreads || expandThreads
+		}
+		return *job, nil
+	}
+
+	id, err := randomString(12)
+	if err != nil {
+		return SyncJob{}, err
+	}
+
+	now := j.syncer.twitter.now()
+	for id, job := range j.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > syncJobTTL {
+			delete(j.jobs, id)
+		}
+	}
+
+	job := &SyncJob{
+		ID:            id,
+		UserID:        userID,
+		State:         SyncQueued,
+		Full:          full,
+		CreatedAt:     now,
+		ExpandThreads: expandThreads,
+	}
+	j.jobs[id] = job
+	j.active[userID] = job
+	j.queue = append(j.queue, job)
+
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+
+	return *job, nil
+}
+
+// Job returns a sync job
+func (j *SyncJobs) Job(id string) (SyncJob, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok {
+		return SyncJob{}, ErrSyncJobNotFound
+	}
+
+	return *job, nil
+}
+
+// Run runs the queued jobs until ctx is done
+func (j *SyncJobs) Run(ctx context.Context) {
+	for {
+		job := j.next()
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-j.wake:
+			}
+			continue
+		}
+
+		j.run(ctx, job)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// next pops the oldest queued job and marks it running, it returns nil when the queue is empty
+func (j *SyncJobs) next() *SyncJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.queue) == 0 {
+		return nil
+	}
+
+	job := j.queue[0]
+	j.queue = j.queue[1:]
+
+	startedAt := j.syncer.twitter.now()
+	job.State = SyncRunning
+	job.StartedAt = &startedAt
+
+	return job
+}
+
+func (j *SyncJobs) run(ctx context.Context, job *SyncJob) {
+	j.mu.Lock()
+	opts := SyncOptions{
+		Full:          job.Full,
+		ExpandThreads: job.ExpandThreads,
+		Progress: func(result SyncResult) {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+
+			job.Pages, job.Fetched, job.Added, job.Matched = result.Pages, result.Fetched, result.Added, result.Matched
+			job.Threads, job.ThreadsFailed = result.Threads, result.ThreadsFailed
+		},
+	}
+	j.mu.Unlock()
+
+	result, err := j.syncer.Sync(ctx, job.UserID, opts)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	finishedAt := j.syncer.twitter.now()
+	job.FinishedAt = &finishedAt
+	job.Pages, job.Fetched, job.Added, job.Removed = result.Pages, result.Fetched, result.Added, result.Removed
+	job.Matched, job.Threads, job.ThreadsFailed = result.Matched, result.Threads, result.ThreadsFailed
+	job.State = SyncSucceeded
+	if err != nil {
+		job.State = SyncFailed
+		job.Error = err.Error()
+	}
+	delete(j.active, job.UserID)
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/services/twittertest"
+)
+
+// runJobs runs the jobs until the test ends
+func runJobs(t *testing.T, jobs *SyncJobs) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		jobs.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitJob waits for a job to finish and returns it
+func waitJob(t *testing.T, jobs *SyncJobs, id string) SyncJob {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := jobs.Job(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.FinishedAt != nil {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still %s", id, job.State)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEnqueueActiveJob(t *testing.T) {
+	e := newTestEnv(t)
+	jobs := NewSyncJobs(NewSyncer(e.twitter, e.store, e.store, e.store))
+
+	first, err := jobs.Enqueue(testUserID, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.State != SyncQueued {
+		t.Errorf("state = %s, want %s", first.State, SyncQueued)
+	}
+
+	second, err := jobs.Enqueue(testUserID, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("second job %s, want the queued job %s", second.ID, first.ID)
+	}
+	if !second.Full || !second.ExpandThreads {
+		t.Errorf("job = %+v, want the queued job upgraded to a full sync expanding threads", second)
+	}
+
+	other, err := jobs.Enqueue("2", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID == first.ID {
+		t.Error("the jobs of two accounts share their ID")
+	}
+}
+
+func TestSyncJobSucceeded(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 150)...)
+	jobs := NewSyncJobs(NewSyncer(e.twitter, e.store, e.store, e.store))
+
+	queued, err := jobs.Enqueue(testUserID, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runJobs(t, jobs)
+
+	job := waitJob(t, jobs, queued.ID)
+	if job.State != SyncSucceeded || job.Error != "" {
+		t.Errorf("job = %+v, want %s", job, SyncSucceeded)
+	}
+	if job.Pages != 2 || job.Added != 150 || job.StartedAt == nil {
+		t.Errorf("job = %+v, want 150 bookmarks added from 2 pages", job)
+	}
+
+	// a finished job no longer absorbs new requests
+	next, err := jobs.Enqueue(testUserID, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID == job.ID {
+		t.Error("finished job returned for a new sync")
+	}
+}
+
+func TestSyncJobFailed(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 150)...)
+	e.fake.FailNext(twittertest.BookmarksEndpoint, http.StatusServiceUnavailable, 4)
+	jobs := NewSyncJobs(NewSyncer(e.twitter, e.store, e.store, e.store))
+
+	queued, err := jobs.Enqueue(testUserID, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runJobs(t, jobs)
+
+	job := waitJob(t, jobs, queued.ID)
+	if job.State != SyncFailed {
+		t.Errorf("state = %s, want %s", job.State, SyncFailed)
+	}
+	if !strings.Contains(job.Error, "status=503") {
+		t.Errorf("error = %q, want the 503 response", job.Error)
+	}
+}
+
+func TestJobNotFound(t *testing.T) {
+	e := newTestEnv(t)
+	jobs := NewSyncJobs(NewSyncer(e.twitter, e.store, e.store, e.store))
+
+	if _, err := jobs.Job("unknown"); !errors.Is(err, ErrSyncJobNotFound) {
+		t.Errorf("err = %v, want ErrSyncJobNotFound", err)
+	}
+}
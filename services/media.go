@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/store"
+)
+
+// maxMediaAttempts is the number of failed downloads after which a media URL is no longer mirrored
+const maxMediaAttempts = 3
+
+// mediaTimeout bounds the download of a media file, videos can be large
+const mediaTimeout = 10 * time.Minute
+
+// ErrMediaTooLarge is returned when a media file exceeds MediaMirrorConfig.MaxSize
+var ErrMediaTooLarge = errors.New("media file too large")
+
+var mediaHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// MediaMirrorConfig configures the mirroring of the archived media
+type MediaMirrorConfig struct {
+	// Dir is the directory holding the mirrored files, named after the SHA-256 of their content
+	Dir string
+	// Interval is the delay between two mirroring runs, it must be positive
+	Interval time.Duration
+	// MaxSize bounds the size in bytes of a mirrored file, 0 means no bound
+	MaxSize int64
+	// Client downloads the media, a client timing out after mediaTimeout when nil
+	Client *http.Client
+	// Now returns the time recorded when a file is mirrored, time.Now when nil
+	Now func() time.Time
+}
+
+// MediaMirrorResult describes a completed mirroring run
+type MediaMirrorResult struct {
+	Mirrored int `json:"mirrored"`
+	Failed   int `json:"failed"`
+}
+
+// MediaMirror downloads the media attached to the archived bookmarks into a content-addressed directory
+type MediaMirror struct {
+	media  store.MediaStore
+	config MediaMirrorConfig
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewMediaMirror creates a MediaMirror recording the mirrored files into media
+func NewMediaMirror(media store.MediaStore, config MediaMirrorConfig) *MediaMirror {
+	client := config.Client
+	if client == nil {
+		client = &http.Client{Timeout: mediaTimeout}
+	}
+
+	now := config.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	return &MediaMirror{
+		media:  media,
+		config: config,
+		client: client,
+		now:    now,
+	}
+}
+
+// Run mirrors the archived media every Interval until ctx is done
+func (m *MediaMirror) Run(ctx context.Context) {
+	for {
+		result, err := m.Mirror(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("failed to mirror media: %v", err)
+		} else if result.Mirrored > 0 || result.Failed > 0 {
+			log.Printf("mirrored %d media files, %d failed", result.Mirrored, result.Failed)
+		}
+
+		if err := sleep(ctx, m.config.Interval); err != nil {
+			return
+		}
+	}
+}
+
+// Mirror downloads the archived media that are not mirrored yet. A failed download is retried by
+// the next runs until it failed maxMediaAttempts times.
+func (m *MediaMirror) Mirror(ctx context.Context) (MediaMirrorResult, error) {
+	var result MediaMirrorResult
+
+	media, err := m.media.ArchivedMedia(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to list archived media: %w", err)
+	}
+
+	var urls []string
+	for _, media := range media {
+		urls = append(urls, MediaURLs(media)...)
+	}
+
+	files, err := m.media.MediaFiles(ctx, urls)
+	if err != nil {
+		return result, fmt.Errorf("failed to list mirrored media: %w", err)
+	}
+
+	for _, url := range urls {
+		file, ok := files[url]
+		if ok && (file.Hash != "" || file.Attempts >= maxMediaAttempts) {
+			continue
+		}
+
+		mirrored, err := m.download(ctx, url)
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		if err != nil {
+			file.URL = url
+			file.Error = err.Error()
+			file.MirroredAt = m.now()
+			mirrored = &file
+			result.Failed++
+		} else {
+			result.Mirrored++
+		}
+		mirrored.Attempts = file.Attempts + 1
+
+		if err := m.media.SaveMediaFile(ctx, *mirrored); err != nil {
+			return result, err
+		}
+		// a URL shared by several media is downloaded once
+		files[url] = *mirrored
+	}
+
+	return result, nil
+}
+
+// download saves the content of url into Dir, under the name of its hash
+func (m *MediaMirror) download(ctx context.Context, url string) (*models.MediaFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download media: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download media: unexpected status %s", resp.Status)
+	}
+	if m.config.MaxSize > 0 && resp.ContentLength > m.config.MaxSize {
+		return nil, ErrMediaTooLarge
+	}
+
+	if err := os.MkdirAll(m.config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create media directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(m.config.Dir, ".download-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create media file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var body io.Reader = resp.Body
+	if m.config.MaxSize > 0 {
+		body = io.LimitReader(resp.Body, m.config.MaxSize+1)
+	}
+
+	// the first bytes sniff the MIME type when the server does not send one
+	var (
+		hash = sha256.New()
+		head = &prefixWriter{max: 512}
+	)
+	size, err := io.Copy(io.MultiWriter(tmp, hash, head), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download media: %w", err)
+	}
+	if m.config.MaxSize > 0 && size > m.config.MaxSize {
+		return nil, ErrMediaTooLarge
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write media file: %w", err)
+	}
+
+	file := &models.MediaFile{
+		URL:        url,
+		Hash:       hex.EncodeToString(hash.Sum(nil)),
+		MIMEType:   resp.Header.Get("Content-Type"),
+		Size:       size,
+		MirroredAt: m.now(),
+	}
+	if file.MIMEType == "" {
+		file.MIMEType = http.DetectContentType(head.data)
+	}
+
+	path := m.path(file.Hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create media directory: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to save media file: %w", err)
+	}
+
+	return file, nil
+}
+
+// Open returns the mirrored file holding the content with the given hash and its path
+func (m *MediaMirror) Open(ctx context.Context, hash string) (*models.MediaFile, string, error) {
+	if !mediaHash.MatchString(hash) {
+		return nil, "", store.ErrNotFound
+	}
+
+	file, err := m.media.MediaFileByHash(ctx, hash)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return file, m.path(hash), nil
+}
+
+// Files returns the mirrored files of urls keyed by URL, urls that are not mirrored are missing
+func (m *MediaMirror) Files(ctx context.Context, urls []string) (map[string]models.MediaFile, error) {
+	files, err := m.media.MediaFiles(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+
+	for url, file := range files {
+		if file.Hash == "" {
+			delete(files, url)
+		}
+	}
+
+	return files, nil
+}
+
+// path spreads the files across subdirectories named after the first byte of their hash
+func (m *MediaMirror) path(hash string) string {
+	return filepath.Join(m.config.Dir, hash[:2], hash)
+}
+
+// MediaURLs returns the URLs of the files of a media worth mirroring: the image, the preview of
+// videos and GIFs and their MP4 variant with the highest bit rate
+func MediaURLs(media models.Media) []string {
+	var urls []string
+	if media.URL != "" {
+		urls = append(urls, media.URL)
+	}
+	if media.PreviewImageURL != "" {
+		urls = append(urls, media.PreviewImageURL)
+	}
+
+	var best *models.MediaVariant
+	for i, variant := range media.Variants {
+		if variant.ContentType == "video/mp4" && (best == nil || variant.BitRate > best.BitRate) {
+			best = &media.Variants[i]
+		}
+	}
+	if best != nil {
+		urls = append(urls, best.URL)
+	}
+
+	return urls
+}
+
+// prefixWriter keeps the first max bytes written to it
+type prefixWriter struct {
+	data []byte
+	max  int
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if n := w.max - len(w.data); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		w.data = append(w.data, p[:n]...)
+	}
+
+	return len(p), nil
+}
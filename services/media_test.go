@@ -0,0 +1,279 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services/twittertest"
+	"twitter-bookmarks/store"
+)
+
+// pngHeader is the signature of PNG images, enough to sniff their MIME type
+var pngHeader = []byte("\x89PNG\x0D\x0A\x1A\x0A")
+
+// mediaServer serves media files and counts the requests for each path
+type mediaServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+// newMediaServer serves the handler of each path until the test ends
+func newMediaServer(t *testing.T, handlers map[string]http.HandlerFunc) *mediaServer {
+	m := &mediaServer{requests: make(map[string]int)}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.requests[r.URL.Path]++
+		m.mu.Unlock()
+
+		handler, ok := handlers[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+// count returns the number of requests for path
+func (m *mediaServer) count(path string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.requests[path]
+}
+
+// serve returns a handler writing body, with contentType unless empty and without sniffing it
+func serve(contentType string, body []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if contentType == "" {
+			w.Header()["Content-Type"] = nil
+		} else {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Write(body)
+	}
+}
+
+// archiveMedia archives a bookmark for each list of media
+func (e *testEnv) archiveMedia(t *testing.T, media ...[]models.Media) {
+	t.Helper()
+
+	bookmarks := twittertest.Bookmarks(1, len(media))
+	for i := range bookmarks {
+		bookmarks[i].Media = media[i]
+	}
+
+	if _, err := e.store.SaveBookmarks(context.Background(), testUserID, bookmarks, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mediaFile returns the file mirroring url
+func (e *testEnv) mediaFile(t *testing.T, url string) models.MediaFile {
+	t.Helper()
+
+	files, err := e.store.MediaFiles(context.Background(), []string{url})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, ok := files[url]
+	if !ok {
+		t.Fatalf("%s never mirrored", url)
+	}
+
+	return file
+}
+
+func TestMirrorMedia(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEnv(t)
+
+	photo, sniffed := []byte("a photo of a gopher"), append(pngHeader, "the rest of the image"...)
+	server := newMediaServer(t, map[string]http.HandlerFunc{
+		"/photo.jpg":   serve("image/jpeg", photo),
+		"/preview.png": serve("", sniffed),
+	})
+
+	shared := models.Media{MediaKey: "3_1", Type: "photo", URL: server.URL + "/photo.jpg"}
+	e.archiveMedia(t,
+		[]models.Media{shared},
+		[]models.Media{shared, {MediaKey: "7_1", Type: "video", PreviewImageURL: server.URL + "/preview.png"}},
+	)
+
+	clock := newTestClock()
+	mirror := NewMediaMirror(e.store, MediaMirrorConfig{Dir: t.TempDir(), Now: clock.Now})
+	result, err := mirror.Mirror(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Mirrored != 2 || result.Failed != 0 {
+		t.Errorf("result = %+v, want 2 files mirrored", result)
+	}
+	if n := server.count("/photo.jpg"); n != 1 {
+		t.Errorf("shared photo downloaded %d times, want once", n)
+	}
+
+	tests := []struct {
+		path     string
+		content  []byte
+		mimeType string
+	}{
+		{"/photo.jpg", photo, "image/jpeg"},
+		{"/preview.png", sniffed, "image/png"},
+	}
+
+	for _, tt := range tests {
+		file := e.mediaFile(t, server.URL+tt.path)
+
+		sum := sha256.Sum256(tt.content)
+		hash := hex.EncodeToString(sum[:])
+		if file.Hash != hash || file.MIMEType != tt.mimeType || file.Size != int64(len(tt.content)) || file.Attempts != 1 {
+			t.Errorf("%s mirrored as %+v, want hash %s, %s and %d bytes", tt.path, file, hash, tt.mimeType, len(tt.content))
+		}
+		if file.MirroredAt.Unix() != clock.Now().Unix() {
+			t.Errorf("%s mirrored at %v, want %v", tt.path, file.MirroredAt, clock.Now())
+		}
+
+		opened, path, err := mirror.Open(ctx, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(mirror.config.Dir, hash[:2], hash); path != want || opened.Hash != hash {
+			t.Errorf("%s opened at %s, want %s", tt.path, path, want)
+		}
+		if content, err := os.ReadFile(path); err != nil || !bytes.Equal(content, tt.content) {
+			t.Errorf("%s content = %q, %v, want %q", tt.path, content, err, tt.content)
+		}
+	}
+
+	// mirrored files are not downloaded again
+	if result, err := mirror.Mirror(ctx); err != nil || result.Mirrored != 0 {
+		t.Errorf("second run = %+v, %v, want nothing mirrored", result, err)
+	}
+	if n := server.count("/photo.jpg"); n != 1 {
+		t.Errorf("photo downloaded %d times, want once", n)
+	}
+}
+
+func TestMirrorMediaMaxSize(t *testing.T) {
+	e := newTestEnv(t)
+
+	large := bytes.Repeat([]byte("x"), 100)
+	server := newMediaServer(t, map[string]http.HandlerFunc{
+		"/length.jpg": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(large)))
+			w.Write(large)
+		},
+		"/chunked.jpg": func(w http.ResponseWriter, r *http.Request) {
+			// flushing before writing the body leaves its length unknown
+			w.(http.Flusher).Flush()
+			w.Write(large)
+		},
+		"/small.jpg": serve("image/jpeg", large[:10]),
+	})
+
+	e.archiveMedia(t, []models.Media{
+		{MediaKey: "3_1", Type: "photo", URL: server.URL + "/length.jpg"},
+		{MediaKey: "3_2", Type: "photo", URL: server.URL + "/chunked.jpg"},
+		{MediaKey: "3_3", Type: "photo", URL: server.URL + "/small.jpg"},
+	})
+
+	dir := t.TempDir()
+	result, err := NewMediaMirror(e.store, MediaMirrorConfig{Dir: dir, MaxSize: 50}).Mirror(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Mirrored != 1 || result.Failed != 2 {
+		t.Errorf("result = %+v, want 1 file mirrored and 2 failed", result)
+	}
+
+	for _, path := range []string{"/length.jpg", "/chunked.jpg"} {
+		if file := e.mediaFile(t, server.URL+path); file.Hash != "" || file.Error != ErrMediaTooLarge.Error() {
+			t.Errorf("%s mirrored as %+v, want too large", path, file)
+		}
+	}
+	if file := e.mediaFile(t, server.URL+"/small.jpg"); file.Hash == "" {
+		t.Errorf("small file mirrored as %+v, want saved", file)
+	}
+
+	// the downloads cut short leave no file behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		t.Errorf("media directory holds %v, want the directory of the small file only", entries)
+	}
+}
+
+func TestMirrorMediaRetries(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEnv(t)
+
+	server := newMediaServer(t, map[string]http.HandlerFunc{
+		"/broken.jpg": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+	})
+	e.archiveMedia(t, []models.Media{{MediaKey: "3_1", Type: "photo", URL: server.URL + "/broken.jpg"}})
+
+	clock := newTestClock()
+	mirror := NewMediaMirror(e.store, MediaMirrorConfig{Dir: t.TempDir(), Now: clock.Now})
+	var lastAttempt time.Time
+	for run := 1; run <= maxMediaAttempts+2; run++ {
+		if run <= maxMediaAttempts {
+			lastAttempt = clock.Now()
+		}
+		result, err := mirror.Mirror(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		failed := 0
+		if run <= maxMediaAttempts {
+			failed = 1
+		}
+		if result.Failed != failed || result.Mirrored != 0 {
+			t.Errorf("run %d = %+v, want %d failed", run, result, failed)
+		}
+		clock.Advance(time.Hour)
+	}
+
+	if n := server.count("/broken.jpg"); n != maxMediaAttempts {
+		t.Errorf("downloaded %d times, want %d", n, maxMediaAttempts)
+	}
+	if file := e.mediaFile(t, server.URL+"/broken.jpg"); file.Attempts != maxMediaAttempts || file.Error == "" ||
+		file.MirroredAt.Unix() != lastAttempt.Unix() {
+		t.Errorf("file = %+v, want %d failed attempts, the last at %v", file, maxMediaAttempts, lastAttempt)
+	}
+}
+
+func TestOpenMedia(t *testing.T) {
+	e := newTestEnv(t)
+	mirror := NewMediaMirror(e.store, MediaMirrorConfig{Dir: t.TempDir()})
+
+	sum := sha256.Sum256([]byte("never mirrored"))
+	for _, hash := range []string{"", "../../etc/passwd", "ABC", hex.EncodeToString(sum[:])} {
+		if _, _, err := mirror.Open(context.Background(), hash); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("Open(%q) err = %v, want ErrNotFound", hash, err)
+		}
+	}
+}
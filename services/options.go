@@ -0,0 +1,81 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Options configures a TwitterService
+type Options func(*TwitterService)
+
+// FieldSet selects the fields and expansions requested along with the bookmarks
+type FieldSet struct {
+	TweetFields []string
+	Expansions  []string
+	UserFields  []string
+	MediaFields []string
+}
+
+// DefaultFieldSet returns the fields and expansions needed to fill every models.Bookmark field
+func DefaultFieldSet() FieldSet {
+	return FieldSet{
+		TweetFields: []string{"created_at", "author_id", "entities", "public_metrics", "attachments", "lang", "referenced_tweets", "conversation_id"},
+		Expansions: []string{
+			"author_id", "entities.mentions.username", "attachments.media_keys",
+			"referenced_tweets.id", "referenced_tweets.id.author_id", "referenced_tweets.id.attachments.media_keys",
+		},
+		UserFields:  []string{"name", "username", "profile_image_url", "verified"},
+		MediaFields: []string{"type", "url", "preview_image_url", "width", "height", "duration_ms", "alt_text", "variants"},
+	}
+}
+
+// WithFields sets the fields and expansions requested along with the bookmarks
+func WithFields(fields FieldSet) Options {
+	return func(s *TwitterService) {
+		s.fields = fields
+	}
+}
+
+// WithRateLimitPolicy sets how requests behave when a rate limit is reached or the API fails
+func WithRateLimitPolicy(policy RateLimitPolicy) Options {
+	return func(s *TwitterService) {
+		s.rateLimitPolicy = policy
+	}
+}
+
+// WithBaseURL sets the base URL of the Twitter API, such as a local stand-in server
+func WithBaseURL(baseURL string) Options {
+	return func(s *TwitterService) {
+		s.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithAuthBaseURL sets the base URL of the page where users authorize the application
+func WithAuthBaseURL(authBaseURL string) Options {
+	return func(s *TwitterService) {
+		s.authBaseURL = strings.TrimSuffix(authBaseURL, "/")
+	}
+}
+
+// WithHTTPClient sets the client used to call the Twitter API
+func WithHTTPClient(client *http.Client) Options {
+	return func(s *TwitterService) {
+		s.client = client
+	}
+}
+
+// WithTransport sets the transport of the client used to call the Twitter API, including a client
+// set by WithHTTPClient whatever the order of the options
+func WithTransport(transport http.RoundTripper) Options {
+	return func(s *TwitterService) {
+		s.transport = transport
+	}
+}
+
+// WithClock sets the function telling the current time, used for token expiry, rate limits and cached profiles
+func WithClock(now func() time.Time) Options {
+	return func(s *TwitterService) {
+		s.now = now
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"twitter-bookmarks/models"
+)
+
+const (
+	// MaxPageSize is the largest page of bookmarks the Twitter API returns
+	MaxPageSize = 100
+
+	// MaxBookmarks is how many of the most recent bookmarks the Twitter API gives access to
+	MaxBookmarks = 800
+)
+
+// ErrNoMorePages is returned by BookmarkPages.Next once every page was read
+var ErrNoMorePages = errors.New("no more pages")
+
+// PageOptions selects a page of bookmarks, the zero value is the first page with the API default size
+type PageOptions struct {
+	// Cursor is the next cursor returned with the previous page
+	Cursor string
+	// Limit is the number of bookmarks in the page, between 1 and MaxPageSize
+	Limit int
+}
+
+// Validate checks the options are accepted by the Twitter API
+func (o PageOptions) Validate() error {
+	if o.Limit < 0 || o.Limit > MaxPageSize {
+		return fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+	}
+
+	return nil
+}
+
+// BookmarkPages walks the bookmark pages of an account, from the most recent bookmark
+type BookmarkPages struct {
+	service *TwitterService
+	userID  string
+	opts    PageOptions
+	done    bool
+}
+
+// BookmarkPages returns an iterator over the bookmark pages of an account starting at opts
+func (s *TwitterService) BookmarkPages(userID string, opts PageOptions) *BookmarkPages {
+	return &BookmarkPages{
+		service: s,
+		userID:  userID,
+		opts:    opts,
+	}
+}
+
+// Next fetches the next page, it returns ErrNoMorePages after the last page
+func (p *BookmarkPages) Next(ctx context.Context) (*models.BookmarkResponse, error) {
+	if p.done {
+		return nil, ErrNoMorePages
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	page, err := p.service.GetBookmarks(ctx, p.userID, p.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	p.opts.Cursor = page.NextCursor
+	p.done = page.NextCursor == ""
+
+	return page, nil
+}
+
+// GetAllBookmarks walks every bookmark page of an account, up to MaxBookmarks bookmarks
+func (s *TwitterService) GetAllBookmarks(ctx context.Context, userID string) ([]models.Bookmark, error) {
+	pages := s.BookmarkPages(userID, PageOptions{Limit: MaxPageSize})
+
+	bookmarks := make([]models.Bookmark, 0)
+	for len(bookmarks) < MaxBookmarks {
+		page, err := pages.Next(ctx)
+		if err != nil {
+			if errors.Is(err, ErrNoMorePages) {
+				break
+			}
+			return nil, err
+		}
+
+		bookmarks = append(bookmarks, page.Bookmarks...)
+	}
+
+	return bookmarks, nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit is the state of a Twitter API rate limit window as reported by the x-rate-limit headers
+type RateLimit struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// EndpointRateLimit is the rate limit of an endpoint for an account
+type EndpointRateLimit struct {
+	Endpoint string `json:"endpoint"`
+	RateLimit
+}
+
+// RateLimitError is returned when the Twitter API rate limit of an endpoint is exhausted
+type RateLimitError struct {
+	Endpoint   string
+	RateLimit  RateLimit
+	RetryAfter time.Duration
+	// APIError is the 429 response of the API, it is nil when the request was not sent
+	// because the rate limit was already known to be exhausted
+	APIError *APIError
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("Twitter API rate limit exceeded for %s, retry after %s", e.Endpoint, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	if e.APIError == nil {
+		return nil
+	}
+
+	return e.APIError
+}
+
+// RateLimitPolicy decides how requests behave when a rate limit is reached or the API fails
+type RateLimitPolicy struct {
+	// MaxWait is the longest the service waits for a rate limit window to reset, longer waits fail fast with a RateLimitError
+	MaxWait time.Duration
+	// MaxRetries is how many times a GET request is retried after a 429 or 5xx response
+	MaxRetries int
+	// BaseBackoff is the initial delay between retries of a failed GET request, it doubles on each attempt
+	BaseBackoff time.Duration
+}
+
+// DefaultRateLimitPolicy fails fast unless the rate limit resets within a few seconds
+func DefaultRateLimitPolicy() RateLimitPolicy {
+	return RateLimitPolicy{
+		MaxWait:     5 * time.Second,
+		MaxRetries:  3,
+		BaseBackoff: 500 * time.Millisecond,
+	}
+}
+
+// backoff returns a random delay up to BaseBackoff * 2^attempt
+func (p RateLimitPolicy) backoff(attempt int) time.Duration {
+	max := p.BaseBackoff << attempt
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// rateLimits tracks the last rate limit seen for each account and endpoint
+type rateLimits struct {
+	mu     sync.Mutex
+	limits map[string]map[string]RateLimit
+}
+
+func newRateLimits() *rateLimits {
+	return &rateLimits{
+		limits: make(map[string]map[string]RateLimit),
+	}
+}
+
+func (r *rateLimits) record(userID, endpoint string, header http.Header) {
+	limit, ok := parseRateLimit(header)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.limits[userID] == nil {
+		r.limits[userID] = make(map[string]RateLimit)
+	}
+	r.limits[userID][endpoint] = limit
+}
+
+// exhausted returns the rate limit of an endpoint if no request is left in the current window
+func (r *rateLimits) exhausted(userID, endpoint string, now time.Time) (RateLimit, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limit, ok := r.limits[userID][endpoint]
+	if !ok || limit.Remaining > 0 || !limit.Reset.After(now) {
+		return RateLimit{}, false
+	}
+
+	return limit, true
+}
+
+func (r *rateLimits) list(userID string) []EndpointRateLimit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limits := make([]EndpointRateLimit, 0, len(r.limits[userID]))
+	for endpoint, limit := range r.limits[userID] {
+		limits = append(limits, EndpointRateLimit{Endpoint: endpoint, RateLimit: limit})
+	}
+	sort.Slice(limits, func(i, j int) bool { return limits[i].Endpoint < limits[j].Endpoint })
+
+	return limits
+}
+
+// parseRateLimit reads the x-rate-limit headers of a Twitter API response
+func parseRateLimit(header http.Header) (RateLimit, bool) {
+	limit, err := strconv.Atoi(header.Get("x-rate-limit-limit"))
+	if err != nil {
+		return RateLimit{}, false
+	}
+
+	remaining, err := strconv.Atoi(header.Get("x-rate-limit-remaining"))
+	if err != nil {
+		return RateLimit{}, false
+	}
+
+	reset, err := strconv.ParseInt(header.Get("x-rate-limit-reset"), 10, 64)
+	if err != nil {
+		return RateLimit{}, false
+	}
+
+	return RateLimit{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Unix(reset, 0).UTC(),
+	}, true
+}
+
+// retryAfter returns how long to wait before retrying a rate limited request, from the
+// Retry-After header when present, otherwise from the rate limit reset time
+func retryAfter(header http.Header, limit RateLimit, now time.Time) time.Duration {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+
+		if date, err := http.ParseTime(value); err == nil {
+			return nonNegative(date.Sub(now))
+		}
+	}
+
+	if limit.Reset.IsZero() {
+		return 0
+	}
+
+	return nonNegative(limit.Reset.Sub(now))
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+
+	return d
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
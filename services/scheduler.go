@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// SchedulerConfig configures the background sync of the connected accounts
+type SchedulerConfig struct {
+	// Interval is the delay between two syncs of an account, it must be positive
+	Interval time.Duration
+	// Jitter is the upper bound of a random delay added to Interval, it spreads the syncs of the accounts
+	Jitter time.Duration
+	// FullInterval is the delay between two full syncs of an account, which detect removed bookmarks.
+	// 0 disables full syncs.
+	FullInterval time.Duration
+	// MaxPages bounds the number of pages fetched by each sync, 0 means no bound
+	MaxPages int
+	// ExpandThreads archives the thread of each new bookmark
+	ExpandThreads bool
+}
+
+// SyncStatus is the state of the background sync of an account
+type SyncStatus struct {
+	LastRun    *time.Time  `json:"last_run,omitempty"`
+	NextRun    *time.Time  `json:"next_run,omitempty"`
+	LastResult *SyncResult `json:"last_result,omitempty"`
+	LastError  string      `json:"last_error,omitempty"`
+}
+
+type schedule struct {
+	lastRun, nextRun, lastFullRun time.Time
+	result                        *SyncResult
+	err                           error
+}
+
+// Scheduler periodically syncs the bookmarks of every connected account
+type Scheduler struct {
+	syncer *Syncer
+	config SchedulerConfig
+
+	mu        sync.Mutex
+	schedules map[string]schedule
+}
+
+// NewScheduler creates a Scheduler syncing accounts with syncer
+func NewScheduler(syncer *Syncer, config SchedulerConfig) *Scheduler {
+	return &Scheduler{
+		syncer:    syncer,
+		config:    config,
+		schedules: make(map[string]schedule),
+	}
+}
+
+// Run syncs the accounts as they become due until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		wait := s.runDue(ctx)
+		if err := sleep(ctx, wait); err != nil {
+			return
+		}
+	}
+}
+
+// SyncStatus returns the state of the background sync of an account
+func (s *Scheduler) SyncStatus(userID string) SyncStatus {
+	s.mu.Lock()
+	sched := s.schedules[userID]
+	s.mu.Unlock()
+
+	var status SyncStatus
+	if !sched.lastRun.IsZero() {
+		status.LastRun = &sched.lastRun
+	}
+	if !sched.nextRun.IsZero() {
+		status.NextRun = &sched.nextRun
+	}
+	status.LastResult = sched.result
+	if sched.err != nil {
+		status.LastError = sched.err.Error()
+	}
+
+	return status
+}
+
+// runDue syncs the accounts whose next run is due and returns how long to wait for the next one
+func (s *Scheduler) runDue(ctx context.Context) time.Duration {
+	users, err := s.syncer.twitter.Users(ctx)
+	if err != nil {
+		log.Printf("failed to list accounts to sync: %v", err)
+		return s.config.Interval
+	}
+
+	connected := make(map[string]bool, len(users))
+	next := s.now().Add(s.config.Interval)
+	for _, user := range users {
+		if ctx.Err() != nil {
+			return 0
+		}
+		connected[user.ID] = true
+
+		s.mu.Lock()
+		sched, ok := s.schedules[user.ID]
+		s.mu.Unlock()
+
+		if !ok || !sched.nextRun.After(s.now()) {
+			sched = s.sync(ctx, user.ID, sched)
+		}
+
+		if sched.nextRun.Before(next) {
+			next = sched.nextRun
+		}
+	}
+
+	s.mu.Lock()
+	for userID := range s.schedules {
+		if !connected[userID] {
+			delete(s.schedules, userID)
+		}
+	}
+	s.mu.Unlock()
+
+	return nonNegative(next.Sub(s.now()))
+}
+
+// sync runs the sync of an account and schedules its next run, after the rate limit reset when
+// the sync was rate limited
+func (s *Scheduler) sync(ctx context.Context, userID string, sched schedule) schedule {
+	now := s.now()
+	full := s.config.FullInterval > 0 && !now.Before(sched.lastFullRun.Add(s.config.FullInterval))
+
+	result, err := s.syncer.Sync(ctx, userID, SyncOptions{MaxPages: s.config.MaxPages, Full: full, ExpandThreads: s.config.ExpandThreads})
+	if ctx.Err() != nil {
+		return sched
+	}
+
+	sched.lastRun = now
+	sched.result = result
+	sched.err = err
+	sched.nextRun = s.now().Add(s.config.Interval + s.jitter())
+	if err != nil {
+		log.Printf("failed to sync bookmarks of %s: %v", userID, err)
+	} else if full {
+		sched.lastFullRun = now
+	}
+
+	var rateLimitErr *RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		if reset := s.now().Add(rateLimitErr.RetryAfter); reset.After(sched.nextRun) {
+			sched.nextRun = reset
+		}
+	}
+
+	s.mu.Lock()
+	s.schedules[userID] = sched
+	s.mu.Unlock()
+
+	return sched
+}
+
+func (s *Scheduler) jitter() time.Duration {
+	if s.config.Jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(s.config.Jitter)))
+}
+
+func (s *Scheduler) now() time.Time {
+	return s.syncer.twitter.now()
+}
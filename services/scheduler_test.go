@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/services/twittertest"
+	"twitter-bookmarks/store"
+)
+
+// testClock is a clock that only moves when advanced
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Now()}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// newSchedulerEnv creates a testEnv and a Scheduler whose clock, shared with the fake, only moves
+// when advanced
+func newSchedulerEnv(t *testing.T, config SchedulerConfig) (*testEnv, *Scheduler, *testClock) {
+	clock := newTestClock()
+	e := newTestEnv(t, WithClock(clock.Now))
+	e.fake.Now = clock.Now
+
+	return e, NewScheduler(NewSyncer(e.twitter, e.store, e.store, e.store), config), clock
+}
+
+// scheduled returns the sync status of the test account
+func scheduled(t *testing.T, scheduler *Scheduler) SyncStatus {
+	t.Helper()
+
+	status := scheduler.SyncStatus(testUserID)
+	if status.LastRun == nil || status.NextRun == nil {
+		t.Fatalf("status = %+v, want the account scheduled", status)
+	}
+
+	return status
+}
+
+func TestSchedulerRateLimited(t *testing.T) {
+	ctx := context.Background()
+	e, scheduler, clock := newSchedulerEnv(t, SchedulerConfig{Interval: time.Minute})
+	e.fake.RateLimit = 1
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 10)...)
+
+	if wait := scheduler.runDue(ctx); wait != time.Minute {
+		t.Errorf("wait = %s, want the interval", wait)
+	}
+	if status := scheduled(t, scheduler); status.LastError != "" {
+		t.Fatalf("first sync failed: %s", status.LastError)
+	}
+
+	// the rate limit window of the first sync resets 15 minutes after it, the reset is in seconds
+	reset := clock.Now().Add(e.fake.RateLimitWindow).Truncate(time.Second)
+	clock.Advance(time.Minute)
+
+	scheduler.runDue(ctx)
+
+	status := scheduled(t, scheduler)
+	if status.LastError == "" {
+		t.Fatal("second sync succeeded, want it rate limited")
+	}
+	if status.NextRun.Before(reset) {
+		t.Errorf("next run at %s, want after the reset at %s", status.NextRun, reset)
+	}
+
+	// the account is not synced before its next run
+	before := e.requests(twittertest.BookmarksEndpoint)
+	clock.Advance(time.Minute)
+	scheduler.runDue(ctx)
+	if n := e.requests(twittertest.BookmarksEndpoint); n != before {
+		t.Errorf("sent %d requests before the reset", n-before)
+	}
+
+	clock.Advance(e.fake.RateLimitWindow)
+	scheduler.runDue(ctx)
+	if status := scheduled(t, scheduler); status.LastError != "" || !status.LastRun.Equal(clock.Now()) {
+		t.Errorf("status = %+v, want a successful sync after the reset", status)
+	}
+}
+
+func TestSchedulerFullSync(t *testing.T) {
+	ctx := context.Background()
+	e, scheduler, clock := newSchedulerEnv(t, SchedulerConfig{Interval: time.Minute, FullInterval: time.Hour})
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 10)...)
+	scheduler.runDue(ctx)
+
+	e.fake.RemoveBookmark(testUserID, "5")
+
+	// the incremental syncs stop at the first page holding known bookmarks
+	clock.Advance(time.Minute)
+	scheduler.runDue(ctx)
+	if status := scheduled(t, scheduler); status.LastResult.Removed != 0 {
+		t.Errorf("incremental sync removed %d bookmarks", status.LastResult.Removed)
+	}
+
+	clock.Advance(time.Hour)
+	scheduler.runDue(ctx)
+	if status := scheduled(t, scheduler); status.LastResult.Removed != 1 {
+		t.Errorf("full sync result = %+v, want 1 bookmark removed", status.LastResult)
+	}
+
+	bookmark, err := e.store.GetBookmark(ctx, testUserID, "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bookmark.Bookmarked || bookmark.RemovedAt == nil {
+		t.Errorf("bookmark = %+v, want a tombstone", bookmark)
+	}
+	if got := e.archived(t, store.StateBookmarked); len(got) != 9 {
+		t.Errorf("%d bookmarks left, want 9", len(got))
+	}
+}
+
+func TestSchedulerDropsDisconnectedAccounts(t *testing.T) {
+	ctx := context.Background()
+	e, scheduler, clock := newSchedulerEnv(t, SchedulerConfig{Interval: time.Minute})
+	scheduler.runDue(ctx)
+	scheduled(t, scheduler)
+
+	if err := e.store.DeleteUser(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+
+	if wait := scheduler.runDue(ctx); wait != time.Minute {
+		t.Errorf("wait = %s, want the interval", wait)
+	}
+	if status := scheduler.SyncStatus(testUserID); status.LastRun != nil || status.NextRun != nil {
+		t.Errorf("status = %+v, want the account unscheduled", status)
+	}
+	if n := len(scheduler.schedules); n != 0 {
+		t.Errorf("%d schedules left", n)
+	}
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	ctx := context.Background()
+	config := SchedulerConfig{Interval: 10 * time.Minute, Jitter: time.Minute}
+	_, scheduler, clock := newSchedulerEnv(t, config)
+
+	for i := 0; i < 20; i++ {
+		wait := scheduler.runDue(ctx)
+
+		status := scheduled(t, scheduler)
+		if delay := status.NextRun.Sub(*status.LastRun); delay < config.Interval || delay >= config.Interval+config.Jitter {
+			t.Fatalf("run %d: next run %s after the last one, want within [%s, %s)", i, delay, config.Interval, config.Interval+config.Jitter)
+		}
+		if wait > config.Interval+config.Jitter {
+			t.Fatalf("run %d: wait = %s, want at most %s", i, wait, config.Interval+config.Jitter)
+		}
+
+		clock.Advance(wait)
+	}
+}
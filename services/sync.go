@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/store"
+)
+
+// SyncOptions configures a sync
+type SyncOptions struct {
+	// MaxPages bounds the number of pages fetched, 0 means no bound
+	MaxPages int
+	// Full walks every page instead of stopping at the first page holding already archived bookmarks,
+	// which is needed to detect removed bookmarks
+	Full bool
+	// ExpandThreads archives the thread of each new bookmark
+	ExpandThreads bool
+	// Progress is called with the result so far after each page is archived
+	Progress func(SyncResult)
+}
+
+// SyncResult describes a completed sync
+type SyncResult struct {
+	UserID     string    `json:"user_id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Pages      int       `json:"pages"`
+	Fetched    int       `json:"fetched"`
+	Added      int       `json:"added"`
+	Removed    int       `json:"removed"`
+	// Matched is the number of new bookmarks matched by the rules of the account
+	Matched int `json:"matched"`
+	// Threads is the number of threads of new bookmarks archived
+	Threads int `json:"threads"`
+	// ThreadsFailed is the number of threads of new bookmarks that could not be archived, the
+	// expansion stops once the rate limit of the search is exhausted
+	ThreadsFailed int `json:"threads_failed"`
+}
+
+// Syncer copies the bookmarks of the connected accounts into the local archive
+type Syncer struct {
+	locks     sync.Map
+	twitter   *TwitterService
+	bookmarks store.BookmarkStore
+	rules     store.RuleStore
+	threads   store.ThreadStore
+}
+
+// NewSyncer creates a Syncer archiving the bookmarks fetched by twitter into bookmarks and applying
+// the rules of the account to the new ones, their threads are archived into threads
+func NewSyncer(twitter *TwitterService, bookmarks store.BookmarkStore, rules store.RuleStore, threads store.ThreadStore) *Syncer {
+	return &Syncer{
+		twitter:   twitter,
+		bookmarks: bookmarks,
+		rules:     rules,
+		threads:   threads,
+	}
+}
+
+// Sync fetches the bookmarks of an account, most recent first, and archives them. Unless opts.Full
+// is set it stops after the first page holding bookmarks that were already archived, since every
+// older bookmark was archived by a previous sync.
+//
+// When every page was read, archived bookmarks missing from the list are tombstoned as removed.
+// Twitter only returns the MaxBookmarks most recent bookmarks, so removals are not detected once
+// an account holds more.
+//
+// The syncs of an account never overlap, Sync waits for the running one to finish.
+func (s *Syncer) Sync(ctx context.Context, userID string, opts SyncOptions) (*SyncResult, error) {
+	mu, _ := s.locks.LoadOrStore(userID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	result := &SyncResult{
+		UserID:    userID,
+		StartedAt: s.twitter.now(),
+	}
+
+	var (
+		seen     []string
+		complete bool
+		// rateLimited is set once the expansion of threads exhausted the rate limit
+		rateLimited bool
+	)
+
+	rules, err := s.enabledRules(ctx, userID)
+	if err != nil {
+		return result, err
+	}
+
+	pages := s.twitter.BookmarkPages(userID, PageOptions{Limit: MaxPageSize})
+	for opts.MaxPages == 0 || result.Pages < opts.MaxPages {
+		page, err := pages.Next(ctx)
+		if err != nil {
+			if errors.Is(err, ErrNoMorePages) {
+				complete = true
+				break
+			}
+			return result, err
+		}
+		result.Pages++
+		result.Fetched += len(page.Bookmarks)
+		seen = append(seen, tweetIDs(page.Bookmarks)...)
+
+		known, err := s.bookmarks.KnownBookmarks(ctx, userID, tweetIDs(page.Bookmarks))
+		if err != nil {
+			return result, fmt.Errorf("failed to check archived bookmarks: %w", err)
+		}
+
+		// every page is archived at the start of the sync, the order of the bookmarks relies on it
+		matches, err := s.bookmarks.SaveBookmarks(ctx, userID, page.Bookmarks, rules, result.StartedAt)
+		if err != nil {
+			return result, fmt.Errorf("failed to archive bookmarks: %w", err)
+		}
+		result.Added += len(page.Bookmarks) - len(known)
+		result.Matched += matchedBookmarks(matches)
+
+		if opts.ExpandThreads {
+			if err := s.expandThreads(ctx, userID, threadBookmarks(page.Bookmarks, known), result, &rateLimited); err != nil {
+				return result, err
+			}
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(*result)
+		}
+
+		if len(known) > 0 && !opts.Full {
+			break
+		}
+	}
+
+	if complete && len(seen) < MaxBookmarks {
+		removed, err := s.bookmarks.RemoveBookmarks(ctx, userID, seen, s.twitter.now())
+		if err != nil {
+			return result, fmt.Errorf("failed to remove bookmarks: %w", err)
+		}
+		result.Removed = removed
+	}
+
+	result.FinishedAt = s.twitter.now()
+
+	return result, nil
+}
+
+// expandThreads archives threads of new bookmarks. The expansion is best effort, the sync goes on
+// when a thread fails and the threads are no longer expanded once rateLimited is set. Only the
+// cancellation of ctx is returned.
+func (s *Syncer) expandThreads(ctx context.Context, userID string, threads [][]models.Bookmark, result *SyncResult, rateLimited *bool) error {
+	for _, bookmarks := range threads {
+		if *rateLimited {
+			result.ThreadsFailed++
+			continue
+		}
+
+		if _, err := s.expandThread(ctx, userID, bookmarks); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			log.Printf("failed to expand the thread of %s for %s: %v", bookmarks[0].TweetID, userID, err)
+			result.ThreadsFailed++
+
+			var rateLimitErr *RateLimitError
+			*rateLimited = errors.As(err, &rateLimitErr)
+			continue
+		}
+		result.Threads++
+	}
+
+	return nil
+}
+
+// enabledRules returns the enabled rules of an account, applied to the new bookmarks
+func (s *Syncer) enabledRules(ctx context.Context, userID string) ([]models.Rule, error) {
+	rules, err := s.rules.ListRules(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rules: %w", err)
+	}
+
+	enabled := rules[:0]
+	for _, rule := range rules {
+		if rule.Enabled {
+			enabled = append(enabled, rule)
+		}
+	}
+
+	return enabled, nil
+}
+
+// matchedBookmarks returns how many bookmarks were matched by at least one rule
+func matchedBookmarks(matches []models.RuleMatches) int {
+	matched := make(map[string]bool)
+	for _, match := range matches {
+		for _, tweetID := range match.TweetIDs {
+			matched[tweetID] = true
+		}
+	}
+
+	return len(matched)
+}
+
+func tweetIDs(bookmarks []models.Bookmark) []string {
+	ids := make([]string, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		ids = append(ids, bookmark.TweetID)
+	}
+
+	return ids
+}
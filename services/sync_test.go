@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services/twittertest"
+	"twitter-bookmarks/store"
+)
+
+// tickingClock returns a clock moving forward by a second each time it is read
+func tickingClock() func() time.Time {
+	var (
+		mu  sync.Mutex
+		now = time.Now()
+	)
+
+	return func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now = now.Add(time.Second)
+		return now
+	}
+}
+
+// sync runs a sync of the test account
+func (e *testEnv) sync(t *testing.T, opts SyncOptions) *SyncResult {
+	t.Helper()
+
+	result, err := NewSyncer(e.twitter, e.store, e.store, e.store).Sync(context.Background(), testUserID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+// archived returns the tweet IDs of the archived bookmarks in state, in the default order
+func (e *testEnv) archived(t *testing.T, state store.BookmarkState) []string {
+	t.Helper()
+
+	var ids []string
+	filter := store.BookmarkFilter{State: state, Limit: MaxPageSize}
+	for {
+		response, err := e.store.ListBookmarks(context.Background(), testUserID, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, tweetIDs(response.Bookmarks)...)
+
+		if response.NextCursor == "" {
+			return ids
+		}
+		filter.Offset += filter.Limit
+	}
+}
+
+// history returns the events of the test account, most recent first
+func (e *testEnv) history(t *testing.T) []models.BookmarkEvent {
+	t.Helper()
+
+	var events []models.BookmarkEvent
+	filter := store.HistoryFilter{Limit: 100}
+	for {
+		response, err := e.store.BookmarkHistory(context.Background(), testUserID, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, response.Events...)
+
+		if response.NextCursor == "" {
+			return events
+		}
+		filter.Offset += filter.Limit
+	}
+}
+
+func TestSyncFirst(t *testing.T) {
+	e := newTestEnv(t, WithClock(tickingClock()))
+	bookmarks := twittertest.Bookmarks(1, 250)
+	e.fake.AddBookmarks(testUserID, bookmarks...)
+
+	result := e.sync(t, SyncOptions{})
+
+	if result.Pages != 3 || result.Fetched != 250 || result.Added != 250 || result.Removed != 0 {
+		t.Errorf("result = %+v, want 250 bookmarks added from 3 pages", result)
+	}
+
+	// the bookmarks keep the order of Twitter even though each page was archived at another time
+	if got := e.archived(t, store.StateBookmarked); !reflect.DeepEqual(got, tweetIDs(bookmarks)) {
+		t.Errorf("archived = %v, want %v", got, tweetIDs(bookmarks))
+	}
+
+	events := e.history(t)
+	if len(events) != 250 {
+		t.Fatalf("got %d events, want 250", len(events))
+	}
+	for _, event := range events {
+		if event.Type != models.BookmarkAdded {
+			t.Errorf("event %+v, want added", event)
+		}
+	}
+}
+
+func TestSyncIncremental(t *testing.T) {
+	e := newTestEnv(t, WithClock(tickingClock()))
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 250)...)
+	e.sync(t, SyncOptions{})
+
+	e.fake.PrependBookmarks(testUserID, twittertest.Bookmarks(1001, 2)...)
+	before := e.requests(twittertest.BookmarksEndpoint)
+
+	result := e.sync(t, SyncOptions{})
+
+	if result.Pages != 1 || result.Fetched != 100 || result.Added != 2 {
+		t.Errorf("result = %+v, want 2 bookmarks added from the first page", result)
+	}
+	if n := e.requests(twittertest.BookmarksEndpoint) - before; n != 1 {
+		t.Errorf("requested %d pages, want 1", n)
+	}
+
+	archived := e.archived(t, store.StateBookmarked)
+	if len(archived) != 252 || archived[0] != "1001" || archived[1] != "1002" {
+		t.Errorf("archived %d bookmarks starting with %v, want 252 starting with the new ones", len(archived), archived[:2])
+	}
+}
+
+func TestSyncRemoved(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEnv(t)
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 150)...)
+	e.sync(t, SyncOptions{})
+
+	e.fake.RemoveBookmark(testUserID, "120")
+
+	result := e.sync(t, SyncOptions{Full: true})
+
+	if result.Removed != 1 || result.Added != 0 {
+		t.Errorf("result = %+v, want 1 bookmark removed", result)
+	}
+
+	bookmark, err := e.store.GetBookmark(ctx, testUserID, "120")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bookmark.Bookmarked || bookmark.RemovedAt == nil {
+		t.Errorf("bookmark = %+v, want a tombstone", bookmark)
+	}
+	if got := e.archived(t, store.StateRemoved); !reflect.DeepEqual(got, []string{"120"}) {
+		t.Errorf("removed = %v, want [120]", got)
+	}
+
+	events := e.history(t)
+	if len(events) != 151 || events[0].Type != models.BookmarkRemoved || events[0].TweetID != "120" {
+		t.Errorf("latest of %d events = %+v, want 120 removed", len(events), events[0])
+	}
+}
+
+func TestSyncPartial(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 250)...)
+	e.sync(t, SyncOptions{})
+
+	e.fake.RemoveBookmark(testUserID, "50")
+
+	// the bookmarks missing from the pages that were not read must not be tombstoned
+	result := e.sync(t, SyncOptions{Full: true, MaxPages: 1})
+
+	if result.Pages != 1 || result.Removed != 0 {
+		t.Errorf("result = %+v, want a single page read and nothing removed", result)
+	}
+	if got := e.archived(t, store.StateRemoved); len(got) != 0 {
+		t.Errorf("removed = %v, want none", got)
+	}
+	if events := e.history(t); len(events) != 250 {
+		t.Errorf("got %d events, want only the 250 added", len(events))
+	}
+}
+
+func TestSyncStopsOnKnownPage(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 150)...)
+	e.sync(t, SyncOptions{})
+
+	// a removal is only detected once every page was read
+	e.fake.RemoveBookmark(testUserID, "120")
+
+	result := e.sync(t, SyncOptions{})
+
+	if result.Pages != 1 || result.Removed != 0 {
+		t.Errorf("result = %+v, want the sync to stop after the first page", result)
+	}
+}
+
+func TestSyncAppliesRules(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEnv(t)
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 5)...)
+	e.sync(t, SyncOptions{})
+
+	rules := []models.Rule{
+		{Name: "authors", Enabled: true, Match: models.RuleConditions{Authors: []string{"author"}}, Actions: models.RuleActions{Tags: []string{"followed"}}},
+		{Name: "disabled", Match: models.RuleConditions{Authors: []string{"author"}}, Actions: models.RuleActions{Tags: []string{"disabled"}}},
+	}
+	for i := range rules {
+		if err := e.store.CreateRule(ctx, testUserID, &rules[i], time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e.fake.PrependBookmarks(testUserID, twittertest.Bookmarks(101, 2)...)
+
+	result := e.sync(t, SyncOptions{})
+
+	if result.Added != 2 || result.Matched != 2 {
+		t.Errorf("result = %+v, want the 2 new bookmarks matched", result)
+	}
+	for tweetID, want := range map[string][]string{"101": {"followed"}, "102": {"followed"}, "1": nil} {
+		bookmark, err := e.store.GetBookmark(ctx, testUserID, tweetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(bookmark.Tags, want) {
+			t.Errorf("bookmark %s tags = %v, want %v", tweetID, bookmark.Tags, want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/store"
+)
+
+// maxLookupTweets is the number of tweets the Twitter API looks up per request
+const maxLookupTweets = 100
+
+// maxThreadPages bounds the number of search pages read to expand a thread, the replies of an
+// author past the first maxThreadPages*100 are not archived
+const maxThreadPages = 5
+
+// LookupTweets fetches tweets by ID, the deleted and protected tweets are missing from the result
+func (s *TwitterService) LookupTweets(ctx context.Context, userID string, ids []string) ([]models.Tweet, error) {
+	tweets := make([]models.Tweet, 0, len(ids))
+	for start := 0; start < len(ids); start += maxLookupTweets {
+		end := start + maxLookupTweets
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		params := s.fieldParams()
+		params.Set("ids", strings.Join(ids[start:end], ","))
+
+		response, err := s.getTweets(ctx, userID, tweetsEndpoint, s.baseURL+"/2/tweets?"+params.Encode())
+		if err != nil {
+			return nil, err
+		}
+		tweets = append(tweets, bookmarkTweets(response.Bookmarks)...)
+	}
+
+	return tweets, nil
+}
+
+// ConversationTweets searches the tweets an author posted in a conversation, most recent first,
+// reading at most maxThreadPages pages. Twitter only searches the tweets of the last 7 days.
+func (s *TwitterService) ConversationTweets(ctx context.Context, userID, conversationID, authorID string) ([]models.Tweet, error) {
+	params := s.fieldParams()
+	params.Set("query", fmt.Sprintf("conversation_id:%s from:%s", conversationID, authorID))
+	params.Set("max_results", "100")
+
+	tweets := make([]models.Tweet, 0)
+	for page := 0; page < maxThreadPages; page++ {
+		response, err := s.getTweets(ctx, userID, searchEndpoint, s.baseURL+"/2/tweets/search/recent?"+params.Encode())
+		if err != nil {
+			return nil, err
+		}
+		tweets = append(tweets, bookmarkTweets(response.Bookmarks)...)
+
+		if response.NextCursor == "" {
+			break
+		}
+		params.Set("next_token", response.NextCursor)
+	}
+
+	return tweets, nil
+}
+
+// getTweets sends a request returning tweets on behalf of an account, the tweets are returned as bookmarks
+func (s *TwitterService) getTweets(ctx context.Context, userID, endpoint, apiURL string) (*models.BookmarkResponse, error) {
+	resp, err := s.do(ctx, userID, endpoint, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	return s.parseBookmarksResponse(resp)
+}
+
+// ExpandThread archives the thread of a bookmarked tweet: the tweets its author posted in its
+// conversation, oldest first. Twitter only searches the tweets of the last 7 days, so the tweets
+// found by the previous expansions of the thread are kept.
+func (s *Syncer) ExpandThread(ctx context.Context, userID string, bookmark models.Bookmark) (*models.Thread, error) {
+	return s.expandThread(ctx, userID, []models.Bookmark{bookmark})
+}
+
+// expandThread archives the thread holding bookmarks, which share their conversation and author
+func (s *Syncer) expandThread(ctx context.Context, userID string, bookmarks []models.Bookmark) (*models.Thread, error) {
+	tweet := bookmarkTweet(bookmarks[0])
+
+	// bookmarks archived before conversations were requested lack their conversation
+	if tweet.ConversationID == "" {
+		found, err := s.twitter.LookupTweets(ctx, userID, []string{tweet.ID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch tweet: %w", err)
+		}
+
+		tweet.ConversationID = tweet.ID
+		if len(found) > 0 && found[0].ConversationID != "" {
+			tweet.ConversationID = found[0].ConversationID
+		}
+	}
+
+	tweets := make(map[string]models.Tweet)
+	stored, err := s.threads.ThreadOf(ctx, userID, tweet.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("failed to load thread: %w", err)
+	}
+	if stored != nil {
+		for _, t := range stored.Tweets {
+			tweets[t.ID] = t
+		}
+	}
+	tweets[tweet.ID] = tweet
+	for _, bookmark := range bookmarks[1:] {
+		tweets[bookmark.TweetID] = bookmarkTweet(bookmark)
+	}
+
+	var found []models.Tweet
+	if tweet.ConversationID != tweet.ID {
+		found, err = s.twitter.LookupTweets(ctx, userID, []string{tweet.ConversationID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch conversation: %w", err)
+		}
+	}
+
+	if tweet.Author.ID != "" {
+		replies, err := s.twitter.ConversationTweets(ctx, userID, tweet.ConversationID, tweet.Author.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search conversation: %w", err)
+		}
+		found = append(found, replies...)
+	}
+
+	for _, t := range found {
+		if t.Author.ID == tweet.Author.ID {
+			tweets[t.ID] = t
+		}
+	}
+
+	thread := models.Thread{
+		ConversationID: tweet.ConversationID,
+		AuthorID:       tweet.Author.ID,
+		Tweets:         make([]models.Tweet, 0, len(tweets)),
+		ExpandedAt:     s.twitter.now(),
+	}
+	for _, t := range tweets {
+		thread.Tweets = append(thread.Tweets, t)
+	}
+	sort.Slice(thread.Tweets, func(i, j int) bool {
+		a, b := thread.Tweets[i], thread.Tweets[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		// tweet IDs grow with time, compare them as numbers
+		return len(a.ID) < len(b.ID) || len(a.ID) == len(b.ID) && a.ID < b.ID
+	})
+
+	if err := s.threads.SaveThread(ctx, userID, &thread); err != nil {
+		return nil, fmt.Errorf("failed to archive thread: %w", err)
+	}
+
+	return &thread, nil
+}
+
+// threadBookmarks groups the bookmarks that are not known by conversation and author, in the order
+// of their first bookmark, so that each thread is expanded once
+func threadBookmarks(bookmarks []models.Bookmark, known map[string]bool) [][]models.Bookmark {
+	var (
+		threads [][]models.Bookmark
+		index   = make(map[string]int)
+	)
+	for _, bookmark := range bookmarks {
+		if known[bookmark.TweetID] {
+			continue
+		}
+
+		// bookmarks lacking their conversation are looked up one by one
+		key := bookmark.TweetID
+		if bookmark.ConversationID != "" {
+			key = bookmark.ConversationID + "/" + bookmark.Author.ID
+		}
+
+		if i, ok := index[key]; ok {
+			threads[i] = append(threads[i], bookmark)
+			continue
+		}
+		index[key] = len(threads)
+		threads = append(threads, []models.Bookmark{bookmark})
+	}
+
+	return threads
+}
+
+// bookmarkTweet returns the tweet of a bookmark
+func bookmarkTweet(bookmark models.Bookmark) models.Tweet {
+	return models.Tweet{
+		ID:               bookmark.TweetID,
+		Text:             bookmark.Text,
+		CreatedAt:        bookmark.CreatedAt,
+		Lang:             bookmark.Lang,
+		ConversationID:   bookmark.ConversationID,
+		Author:           bookmark.Author,
+		PublicMetrics:    bookmark.PublicMetrics,
+		Entities:         bookmark.Entities,
+		Attachments:      bookmark.Attachments,
+		Media:            bookmark.Media,
+		ReferencedTweets: bookmark.ReferencedTweets,
+	}
+}
+
+func bookmarkTweets(bookmarks []models.Bookmark) []models.Tweet {
+	tweets := make([]models.Tweet, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		tweets = append(tweets, bookmarkTweet(bookmark))
+	}
+
+	return tweets
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services/twittertest"
+	"twitter-bookmarks/store"
+)
+
+// threadTweets returns n tweets of the author of twittertest.Bookmarks in a conversation, with IDs
+// counting from first, the oldest first
+func threadTweets(conversationID string, first, n int) []models.Tweet {
+	author := models.Author{ID: "100", Username: "author", Name: "Author"}
+
+	tweets := make([]models.Tweet, 0, n)
+	for id := first; id < first+n; id++ {
+		tweets = append(tweets, models.Tweet{
+			ID:             strconv.Itoa(id),
+			Text:           "reply " + strconv.Itoa(id),
+			CreatedAt:      time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(id) * time.Minute),
+			ConversationID: conversationID,
+			Author:         author,
+		})
+	}
+
+	return tweets
+}
+
+// threadIDs returns the IDs of the tweets of the archived thread holding tweetID
+func (e *testEnv) threadIDs(t *testing.T, tweetID string) []string {
+	t.Helper()
+
+	thread, err := e.store.ThreadOf(context.Background(), testUserID, tweetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]string, 0, len(thread.Tweets))
+	for _, tweet := range thread.Tweets {
+		ids = append(ids, tweet.ID)
+	}
+
+	return ids
+}
+
+// rootBookmarks returns n bookmarks each starting its own conversation
+func rootBookmarks(n int) []models.Bookmark {
+	bookmarks := twittertest.Bookmarks(1, n)
+	for i := range bookmarks {
+		bookmarks[i].ConversationID = bookmarks[i].TweetID
+	}
+
+	return bookmarks
+}
+
+func TestSyncExpandsEachThreadOnce(t *testing.T) {
+	e := newTestEnv(t)
+
+	// 1, 2 and 3 belong to the conversation of 3, 4 starts its own
+	bookmarks := twittertest.Bookmarks(1, 4)
+	for i, conversationID := range []string{"3", "3", "3", "4"} {
+		bookmarks[i].ConversationID = conversationID
+	}
+	e.fake.AddBookmarks(testUserID, bookmarks...)
+	e.fake.AddTweets(threadTweets("3", 500, 2)...)
+
+	result := e.sync(t, SyncOptions{ExpandThreads: true})
+
+	if result.Threads != 2 || result.ThreadsFailed != 0 {
+		t.Errorf("result = %+v, want 2 threads archived", result)
+	}
+	if n := e.requests(twittertest.SearchEndpoint); n != 2 {
+		t.Errorf("searched %d conversations, want 2", n)
+	}
+
+	want := []string{"3", "2", "1", "500", "501"}
+	for _, tweetID := range []string{"1", "2", "3"} {
+		if got := e.threadIDs(t, tweetID); !reflect.DeepEqual(got, want) {
+			t.Errorf("thread of %s = %v, want %v", tweetID, got, want)
+		}
+	}
+	if got := e.threadIDs(t, "4"); !reflect.DeepEqual(got, []string{"4"}) {
+		t.Errorf("thread of 4 = %v, want [4]", got)
+	}
+}
+
+func TestSyncThreadFailureNotFatal(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.AddBookmarks(testUserID, rootBookmarks(2)...)
+	// the first expansion fails after every retry
+	e.fake.FailNext(twittertest.SearchEndpoint, http.StatusServiceUnavailable, 4)
+
+	result := e.sync(t, SyncOptions{ExpandThreads: true})
+
+	if result.Added != 2 || result.Threads != 1 || result.ThreadsFailed != 1 {
+		t.Errorf("result = %+v, want 2 bookmarks added, 1 thread archived and 1 failed", result)
+	}
+	if got := e.archived(t, store.StateBookmarked); len(got) != 2 {
+		t.Errorf("archived %v, want both bookmarks", got)
+	}
+}
+
+func TestSyncThreadsRateLimited(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.RateLimit = 1
+	e.fake.AddBookmarks(testUserID, rootBookmarks(3)...)
+
+	result := e.sync(t, SyncOptions{ExpandThreads: true})
+
+	if result.Added != 3 || result.Threads != 1 || result.ThreadsFailed != 2 {
+		t.Errorf("result = %+v, want 3 bookmarks added, 1 thread archived and 2 failed", result)
+	}
+	if n := e.requests(twittertest.SearchEndpoint); n != 1 {
+		t.Errorf("searched %d conversations, want the expansion to stop at the rate limit", n)
+	}
+}
+
+func TestConversationTweetsBounded(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.AddTweets(threadTweets("1", 1000, maxThreadPages*100+50)...)
+
+	tweets, err := e.twitter.ConversationTweets(context.Background(), testUserID, "1", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tweets) != maxThreadPages*100 {
+		t.Errorf("got %d tweets, want %d", len(tweets), maxThreadPages*100)
+	}
+	if n := e.requests(twittertest.SearchEndpoint); n != maxThreadPages {
+		t.Errorf("requested %d pages, want %d", n, maxThreadPages)
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/store"
+)
+
+// ErrNotAuthenticated is returned when the Twitter account is not connected
+var ErrNotAuthenticated = errors.New("Twitter account not connected")
+
+// refreshLeeway is how long before its expiry an access token is refreshed
+const refreshLeeway = time.Minute
+
+type tokenRefresher interface {
+	RefreshAccessToken(ctx context.Context, refreshToken string) (*models.Token, error)
+}
+
+// TokenSource hands out a valid access token for each account, refreshing and persisting it when needed
+type TokenSource struct {
+	locks     sync.Map
+	store     store.TokenStore
+	refresher tokenRefresher
+	now       func() time.Time
+}
+
+// NewTokenSource creates a TokenSource reading and writing tokens in tokenStore, now tells the current time
+func NewTokenSource(tokenStore store.TokenStore, refresher tokenRefresher, now func() time.Time) *TokenSource {
+	return &TokenSource{
+		store:     tokenStore,
+		refresher: refresher,
+		now:       now,
+	}
+}
+
+// Token returns the access token of an account, refreshing it first if it is about to expire
+func (t *TokenSource) Token(ctx context.Context, userID string) (string, error) {
+	mu := t.lock(userID)
+	defer mu.Unlock()
+
+	token, err := t.load(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if token.ExpiresWithin(t.now(), refreshLeeway) && token.RefreshToken != "" {
+		token, err = t.refresh(ctx, userID, token)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return token.AccessToken, nil
+}
+
+// Refresh renews the access token of an account after it was rejected, rejected is the access token the API refused.
+// If another caller already replaced it, the current token is returned without refreshing again.
+func (t *TokenSource) Refresh(ctx context.Context, userID, rejected string) (string, error) {
+	mu := t.lock(userID)
+	defer mu.Unlock()
+
+	token, err := t.load(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if token.AccessToken != rejected {
+		return token.AccessToken, nil
+	}
+
+	token, err = t.refresh(ctx, userID, token)
+	if err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
+// Save stores a newly issued token for an account
+func (t *TokenSource) Save(ctx context.Context, userID string, token *models.Token) error {
+	mu := t.lock(userID)
+	defer mu.Unlock()
+
+	return t.store.SaveToken(ctx, userID, token)
+}
+
+// Delete forgets the token of an account once revoke succeeded with it
+func (t *TokenSource) Delete(ctx context.Context, userID string, revoke func(ctx context.Context, token *models.Token) error) error {
+	mu := t.lock(userID)
+	defer mu.Unlock()
+
+	token, err := t.load(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := revoke(ctx, token); err != nil {
+		return err
+	}
+
+	return t.store.DeleteToken(ctx, userID)
+}
+
+// lock serializes token operations per account so a refresh token is never used twice
+func (t *TokenSource) lock(userID string) *sync.Mutex {
+	mu, _ := t.locks.LoadOrStore(userID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+
+	return mu.(*sync.Mutex)
+}
+
+func (t *TokenSource) load(ctx context.Context, userID string) (*models.Token, error) {
+	token, err := t.store.LoadToken(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrNotAuthenticated
+		}
+		return nil, fmt.Errorf("failed to load token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (t *TokenSource) refresh(ctx context.Context, userID string, token *models.Token) (*models.Token, error) {
+	if token.RefreshToken == "" {
+		return nil, ErrNotAuthenticated
+	}
+
+	refreshed, err := t.refresher.RefreshAccessToken(ctx, token.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+
+	if err := t.store.SaveToken(ctx, userID, refreshed); err != nil {
+		return nil, fmt.Errorf("failed to save refreshed token: %w", err)
+	}
+
+	return refreshed, nil
+}
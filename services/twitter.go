@@ -2,126 +2,317 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"twitter-bookmarks/models"
+	"twitter-bookmarks/store"
 )
 
+const (
+	// DefaultBaseURL is the base URL of the Twitter API
+	DefaultBaseURL = "https://api.twitter.com"
+	// DefaultAuthBaseURL is the base URL of the page where users authorize the application
+	DefaultAuthBaseURL = "https://twitter.com"
+)
+
+// Endpoints identify the rate limit a request counts against
+const (
+	meEndpoint        = "GET /2/users/me"
+	bookmarksEndpoint = "GET /2/users/:id/bookmarks"
+	tweetsEndpoint    = "GET /2/tweets"
+	searchEndpoint    = "GET /2/tweets/search/recent"
+)
+
+// profileTTL is how long the cached profile of an account is served before being fetched again
+const profileTTL = 24 * time.Hour
+
+// userFields are the user fields requested when fetching the profile of an account
+var userFields = []string{
+	"created_at", "description", "location", "profile_image_url", "protected", "public_metrics", "url", "verified",
+}
+
+// DefaultScopes are the OAuth2 scopes requested when authorizing the application.
+var DefaultScopes = []string{"tweet.read", "users.read", "bookmark.read", "offline.access"}
+
 type TwitterService struct {
 	clientID     string
 	clientSecret string
 	redirectURI  string
-	codeVerifier string
-	refreshToken string
+	scopes       []string
+	fields       FieldSet
+	baseURL      string
+	authBaseURL  string
 	client       *http.Client
-	userID       string
+	transport    http.RoundTripper
+	now          func() time.Time
+	users        store.UserStore
+	tokens       *TokenSource
+
+	rateLimitPolicy RateLimitPolicy
+	rateLimits      *rateLimits
 }
 
-func NewTwitterService(clientID, clientSecret, redirectURI string) *TwitterService {
-	return &TwitterService{
+func NewTwitterService(clientID, clientSecret, redirectURI string, accounts store.AccountStore, options ...Options) *TwitterService {
+	s := &TwitterService{
 		clientID:     clientID,
 		clientSecret: clientSecret,
 		redirectURI:  redirectURI,
+		scopes:       DefaultScopes,
+		fields:       DefaultFieldSet(),
+		baseURL:      DefaultBaseURL,
+		authBaseURL:  DefaultAuthBaseURL,
 		client: &http.Client{
 			Timeout: time.Second * 10,
 		},
+		now:             time.Now,
+		users:           accounts,
+		rateLimitPolicy: DefaultRateLimitPolicy(),
+		rateLimits:      newRateLimits(),
+	}
+
+	for _, o := range options {
+		o(s)
 	}
-}
 
-// GenerateCodeVerifier creates a PKCE code verifier
-func GenerateCodeVerifier() string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-._~"
-	const length = 43
-	verifier := make([]byte, length)
-	for i := range verifier {
-		verifier[i] = charset[time.Now().UnixNano()%int64(len(charset))]
+	// the transport applies to a copy, leaving a client given by WithHTTPClient untouched
+	if s.transport != nil {
+		client := *s.client
+		client.Transport = s.transport
+		s.client = &client
 	}
-	return string(verifier)
+
+	s.tokens = NewTokenSource(accounts, s, s.now)
+
+	return s
+}
+
+// GenerateCodeVerifier creates a PKCE code verifier from a cryptographically random source
+func GenerateCodeVerifier() (string, error) {
+	return randomString(32)
 }
 
-// Authenticate authenticates the user and retrieves an access token
-func (s *TwitterService) Authenticate(ctx context.Context, authorizationCode string) (string, error) {
-	s.codeVerifier = GenerateCodeVerifier()
+// GenerateCodeChallenge creates the S256 code challenge for a PKCE code verifier
+func GenerateCodeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
 
-	apiURL := "https://api.twitter.com/2/oauth2/token"
+// GenerateState creates an opaque value used to bind an authorization request to its callback
+func GenerateState() (string, error) {
+	return randomString(16)
+}
 
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthorizeURL returns the URL the user must visit to grant the application access
+func (s *TwitterService) AuthorizeURL(state, codeChallenge string) string {
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", s.clientID)
+	params.Set("redirect_uri", s.redirectURI)
+	params.Set("scope", strings.Join(s.scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	return s.authBaseURL + "/i/oauth2/authorize?" + params.Encode()
+}
+
+// Authenticate exchanges an authorization code and its PKCE code verifier for a token,
+// then registers the account it belongs to and stores the token
+func (s *TwitterService) Authenticate(ctx context.Context, authorizationCode, codeVerifier string) (*models.User, error) {
 	data := url.Values{}
 	data.Set("client_id", s.clientID)
 	data.Set("grant_type", "authorization_code")
 	data.Set("code", authorizationCode)
 	data.Set("redirect_uri", s.redirectURI)
-	data.Set("code_verifier", s.codeVerifier)
+	data.Set("code_verifier", codeVerifier)
 
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(data.Encode()))
+	token, err := s.requestToken(ctx, data)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err := s.client.Do(req)
+	resp, err := s.send(ctx, s.newMeRequest, token.AccessToken)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("error from API: status=%d, body=%s", resp.StatusCode, string(body))
+	user, err := s.parseMeResponse(resp)
+	if err != nil {
+		return nil, err
 	}
 
-	var tokenResponse struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token"`
-		ExpiresIn    int    `json:"expires_in"`
-		TokenType    string `json:"token_type"`
-		Scope        string `json:"scope"`
+	if err := s.users.SaveUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to save user: %w", err)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+	if err := s.tokens.Save(ctx, user.ID, token); err != nil {
+		return nil, fmt.Errorf("failed to save token: %w", err)
 	}
 
-	s.refreshToken = tokenResponse.RefreshToken
+	return user, nil
+}
 
-	return tokenResponse.AccessToken, nil
+// Users returns the connected accounts
+func (s *TwitterService) Users(ctx context.Context) ([]models.User, error) {
+	return s.users.ListUsers(ctx)
 }
 
-// RefreshAccessToken renews the access token using the refresh token
-func (s *TwitterService) RefreshAccessToken(ctx context.Context) (string, error) {
-	if s.refreshToken == "" {
-		return "", fmt.Errorf("no refresh token available")
+// User returns a connected account
+func (s *TwitterService) User(ctx context.Context, userID string) (*models.User, error) {
+	user, err := s.users.GetUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrNotAuthenticated
+		}
+		return nil, err
 	}
 
-	apiURL := "https://api.twitter.com/2/oauth2/token"
+	return user, nil
+}
 
+// RefreshAccessToken renews an access token using the refresh token
+func (s *TwitterService) RefreshAccessToken(ctx context.Context, refreshToken string) (*models.Token, error) {
 	data := url.Values{}
 	data.Set("client_id", s.clientID)
 	data.Set("grant_type", "refresh_token")
-	data.Set("refresh_token", s.refreshToken)
+	data.Set("refresh_token", refreshToken)
+
+	return s.requestToken(ctx, data)
+}
+
+// Me returns the profile of an account, fetching it from /2/users/me when the cached one is
+// older than profileTTL or refresh is set
+func (s *TwitterService) Me(ctx context.Context, userID string, refresh bool) (*models.User, error) {
+	user, err := s.User(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !refresh && s.now().Sub(user.UpdatedAt) < profileTTL {
+		return user, nil
+	}
+
+	resp, err := s.do(ctx, userID, meEndpoint, s.newMeRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err = s.parseMeResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.ID != userID {
+		return nil, fmt.Errorf("token of account %s belongs to account %s", userID, user.ID)
+	}
+
+	if err := s.users.SaveUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to save user: %w", err)
+	}
+
+	return user, nil
+}
+
+// Revoke revokes the tokens of an account on Twitter and removes the account. The account is kept
+// when Twitter fails to revoke a token, unless the token is already invalid.
+func (s *TwitterService) Revoke(ctx context.Context, userID string) error {
+	if err := s.tokens.Delete(ctx, userID, s.revokeToken); err != nil {
+		return err
+	}
+
+	if err := s.users.DeleteUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return nil
+}
+
+// revokeToken revokes the refresh token of an account, which also revokes its access tokens, then
+// its access token in case Twitter keeps it valid
+func (s *TwitterService) revokeToken(ctx context.Context, token *models.Token) error {
+	if token.RefreshToken != "" {
+		if err := s.revoke(ctx, token.RefreshToken, "refresh_token"); err != nil {
+			return err
+		}
+	}
+
+	return s.revoke(ctx, token.AccessToken, "access_token")
+}
+
+// unknownTokenDescription is the description of the invalid_request error Twitter returns when
+// revoking a token it does not know, such as an expired or already revoked token
+const unknownTokenDescription = "token was invalid"
+
+// revoke revokes a token of the type given by hint, tokens that are already invalid are ignored
+func (s *TwitterService) revoke(ctx context.Context, value, hint string) error {
+	data := url.Values{}
+	data.Set("client_id", s.clientID)
+	data.Set("token", value)
+	data.Set("token_type_hint", hint)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+"/2/oauth2/revoke", strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.setClientCredentials(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	apiErr := newAPIError(resp)
+	if apiErr.StatusCode == http.StatusBadRequest && (apiErr.Title == "invalid_token" ||
+		apiErr.Title == "invalid_request" && strings.Contains(strings.ToLower(apiErr.Detail), unknownTokenDescription)) {
+		return nil
+	}
+
+	return apiErr
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(data.Encode()))
+func (s *TwitterService) requestToken(ctx context.Context, data url.Values) (*models.Token, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+"/2/oauth2/token", strings.NewReader(data.Encode()))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.setClientCredentials(req)
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("error from API: status=%d, body=%s", resp.StatusCode, string(body))
+		return nil, newAPIError(resp)
 	}
 
 	var tokenResponse struct {
@@ -133,75 +324,243 @@ func (s *TwitterService) RefreshAccessToken(ctx context.Context) (string, error)
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	if tokenResponse.RefreshToken != "" {
-		s.refreshToken = tokenResponse.RefreshToken
+	token := &models.Token{
+		AccessToken:  tokenResponse.AccessToken,
+		RefreshToken: tokenResponse.RefreshToken,
+		Scopes:       strings.Fields(tokenResponse.Scope),
+	}
+	if tokenResponse.ExpiresIn > 0 {
+		token.Expiry = s.now().Add(time.Duration(tokenResponse.ExpiresIn) * time.Second)
 	}
 
-	return tokenResponse.AccessToken, nil
+	return token, nil
 }
 
-// GetBookmarks gets the bookmarks for a user
-func (s *TwitterService) GetBookmarks(ctx context.Context, token string) (*models.BookmarkResponse, error) {
-	url := fmt.Sprintf("https://api.twitter.com/2/users/%s/bookmarks", s.userID)
+// setClientCredentials authenticates confidential clients with HTTP basic auth, public clients only send client_id
+func (s *TwitterService) setClientCredentials(req *http.Request) {
+	if s.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret))
+	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+func (s *TwitterService) newMeRequest(ctx context.Context) (*http.Request, error) {
+	params := url.Values{}
+	params.Set("user.fields", strings.Join(userFields, ","))
+
+	return http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/2/users/me?"+params.Encode(), nil)
+}
+
+// parseMeResponse returns the account described by a /2/users/me response
+func (s *TwitterService) parseMeResponse(resp *http.Response) (*models.User, error) {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var meResponse struct {
+		Data models.User `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&meResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if meResponse.Data.ID == "" {
+		return nil, fmt.Errorf("Twitter API error: missing user id")
+	}
+	meResponse.Data.UpdatedAt = s.now()
+
+	return &meResponse.Data, nil
+}
+
+// do sends an authorized request for an account built by newRequest. The access token is refreshed
+// once if it is rejected, and GET requests are retried according to the rate limit policy.
+// endpoint identifies the rate limit the request counts against.
+func (s *TwitterService) do(ctx context.Context, userID, endpoint string, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	token, err := s.tokens.Token(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("échec de création de la requête: %w", err)
+		return nil, err
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		if err := s.waitRateLimit(ctx, userID, endpoint); err != nil {
+			return nil, err
+		}
+
+		resp, err := s.send(ctx, newRequest, token)
+		if err != nil {
+			return nil, err
+		}
+		s.rateLimits.record(userID, endpoint, resp.Header)
+
+		retryable := resp.Request.Method == http.MethodGet && attempt < s.rateLimitPolicy.MaxRetries
+
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && !refreshed:
+			resp.Body.Close()
+
+			token, err = s.tokens.Refresh(ctx, userID, token)
+			if err != nil {
+				return nil, err
+			}
+			refreshed = true
+		case resp.StatusCode == http.StatusTooManyRequests:
+			apiErr := newAPIError(resp)
+			resp.Body.Close()
+
+			limit, _ := parseRateLimit(resp.Header)
+			rateLimitErr := &RateLimitError{
+				Endpoint:   endpoint,
+				RateLimit:  limit,
+				RetryAfter: retryAfter(resp.Header, limit, s.now()),
+				APIError:   apiErr,
+			}
+			if !retryable || rateLimitErr.RetryAfter > s.rateLimitPolicy.MaxWait {
+				return nil, rateLimitErr
+			}
+
+			wait := s.rateLimitPolicy.backoff(attempt)
+			if rateLimitErr.RetryAfter > wait {
+				wait = rateLimitErr.RetryAfter
+			}
+
+			if err := sleep(ctx, wait); err != nil {
+				return nil, err
+			}
+		case resp.StatusCode >= http.StatusInternalServerError && retryable:
+			resp.Body.Close()
+
+			if err := sleep(ctx, s.rateLimitPolicy.backoff(attempt)); err != nil {
+				return nil, err
+			}
+		default:
+			return resp, nil
+		}
+	}
+}
+
+// waitRateLimit waits for the rate limit window of an endpoint to reset when no request is left in it,
+// or fails fast with a RateLimitError when the reset is further away than the policy allows
+func (s *TwitterService) waitRateLimit(ctx context.Context, userID, endpoint string) error {
+	now := s.now()
+
+	limit, exhausted := s.rateLimits.exhausted(userID, endpoint, now)
+	if !exhausted {
+		return nil
+	}
+
+	wait := limit.Reset.Sub(now)
+	if wait > s.rateLimitPolicy.MaxWait {
+		return &RateLimitError{
+			Endpoint:   endpoint,
+			RateLimit:  limit,
+			RetryAfter: wait,
+		}
+	}
+
+	return sleep(ctx, wait)
+}
+
+// RateLimits returns the last rate limit seen for each endpoint called on behalf of an account
+func (s *TwitterService) RateLimits(userID string) []EndpointRateLimit {
+	return s.rateLimits.list(userID)
+}
+
+func (s *TwitterService) send(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error), token string) (*http.Response, error) {
+	req, err := newRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := s.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
+
+	return resp, nil
+}
+
+// GetBookmarks gets a page of bookmarks for a user
+func (s *TwitterService) GetBookmarks(ctx context.Context, userID string, opts PageOptions) (*models.BookmarkResponse, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	params := s.fieldParams()
+	if opts.Limit != 0 {
+		params.Set("max_results", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		params.Set("pagination_token", opts.Cursor)
+	}
+
+	apiURL := fmt.Sprintf("%s/2/users/%s/bookmarks", s.baseURL, url.PathEscape(userID))
+	if len(params) > 0 {
+		apiURL += "?" + params.Encode()
+	}
+
+	resp, err := s.do(ctx, userID, bookmarksEndpoint, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Twitter API error: status=%d", resp.StatusCode)
+		return nil, newAPIError(resp)
 	}
 
 	return s.parseBookmarksResponse(resp)
 }
 
-// GetBookmarksAfterDate gets the bookmarks for a user after a specific date
-func (s *TwitterService) GetBookmarksAfterDate(ctx context.Context, token string, after time.Time) (*models.BookmarkResponse, error) {
-	bookmarks, err := s.GetBookmarks(ctx, token)
-	if err != nil {
-		return nil, err
+// fieldParams returns the query parameters requesting the fields and expansions of s.fields
+func (s *TwitterService) fieldParams() url.Values {
+	params := url.Values{}
+	if len(s.fields.TweetFields) > 0 {
+		params.Set("tweet.fields", strings.Join(s.fields.TweetFields, ","))
 	}
-
-	var filteredBookmarks []models.Bookmark
-	for _, bookmark := range bookmarks.Bookmarks {
-		if bookmark.CreatedAt.After(after) {
-			filteredBookmarks = append(filteredBookmarks, bookmark)
-		}
+	if len(s.fields.Expansions) > 0 {
+		params.Set("expansions", strings.Join(s.fields.Expansions, ","))
+	}
+	if len(s.fields.UserFields) > 0 {
+		params.Set("user.fields", strings.Join(s.fields.UserFields, ","))
+	}
+	if len(s.fields.MediaFields) > 0 {
+		params.Set("media.fields", strings.Join(s.fields.MediaFields, ","))
 	}
 
-	return &models.BookmarkResponse{
-		Bookmarks: filteredBookmarks,
-		NextToken: bookmarks.NextToken,
-	}, nil
+	return params
+}
+
+// tweetData is a tweet as returned by the v2 API, in data or includes.tweets
+type tweetData struct {
+	ID               string                   `json:"id"`
+	Text             string                   `json:"text"`
+	CreatedAt        time.Time                `json:"created_at"`
+	Lang             string                   `json:"lang"`
+	ConversationID   string                   `json:"conversation_id"`
+	AuthorID         string                   `json:"author_id"`
+	PublicMetrics    models.TweetMetrics      `json:"public_metrics"`
+	Entities         models.Entities          `json:"entities"`
+	Attachments      models.Attachments       `json:"attachments"`
+	ReferencedTweets []models.ReferencedTweet `json:"referenced_tweets"`
 }
 
 func (s *TwitterService) parseBookmarksResponse(resp *http.Response) (*models.BookmarkResponse, error) {
 	var twitterResp struct {
-		Data []struct {
-			ID        string    `json:"id"`
-			Text      string    `json:"text"`
-			CreatedAt time.Time `json:"created_at"`
-			AuthorID  string    `json:"author_id"`
-		} `json:"data"`
+		Data     []tweetData `json:"data"`
 		Includes struct {
-			Users []struct {
-				ID       string `json:"id"`
-				Username string `json:"username"`
-				Name     string `json:"name"`
-			} `json:"users"`
+			Users  []models.Author `json:"users"`
+			Media  []models.Media  `json:"media"`
+			Tweets []tweetData     `json:"tweets"`
 		} `json:"includes"`
 		Meta struct {
 			NextToken string `json:"next_token"`
@@ -212,41 +571,102 @@ func (s *TwitterService) parseBookmarksResponse(resp *http.Response) (*models.Bo
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	userMap := make(map[string]struct {
-		Username string
-		Name     string
-	})
+	userMap := make(map[string]models.Author)
+	userIDs := make(map[string]string)
 	for _, user := range twitterResp.Includes.Users {
-		userMap[user.ID] = struct {
-			Username string
-			Name     string
-		}{
-			Username: user.Username,
-			Name:     user.Name,
+		userMap[user.ID] = user
+		userIDs[strings.ToLower(user.Username)] = user.ID
+	}
+
+	mediaMap := make(map[string]models.Media)
+	for _, media := range twitterResp.Includes.Media {
+		mediaMap[media.MediaKey] = media
+	}
+
+	// resolve fills the author, mention IDs and media of a tweet from the includes
+	resolve := func(tweet tweetData) models.Tweet {
+		author, ok := userMap[tweet.AuthorID]
+		if !ok {
+			author = models.Author{
+				ID: tweet.AuthorID,
+			}
+		}
+
+		// mentions are resolved from the expanded users when the entity lacks the user ID
+		for i, mention := range tweet.Entities.Mentions {
+			if mention.ID == "" {
+				tweet.Entities.Mentions[i].ID = userIDs[strings.ToLower(mention.Username)]
+			}
+		}
+
+		var media []models.Media
+		for _, key := range tweet.Attachments.MediaKeys {
+			if m, ok := mediaMap[key]; ok {
+				media = append(media, m)
+			}
+		}
+
+		return models.Tweet{
+			ID:               tweet.ID,
+			Text:             tweet.Text,
+			CreatedAt:        tweet.CreatedAt,
+			Lang:             tweet.Lang,
+			ConversationID:   tweet.ConversationID,
+			Author:           author,
+			PublicMetrics:    tweet.PublicMetrics,
+			Entities:         tweet.Entities,
+			Attachments:      tweet.Attachments,
+			Media:            media,
+			ReferencedTweets: tweet.ReferencedTweets,
 		}
 	}
 
+	tweetMap := make(map[string]models.Tweet)
+	for _, tweet := range twitterResp.Includes.Tweets {
+		tweetMap[tweet.ID] = resolve(tweet)
+	}
+
 	bookmarks := make([]models.Bookmark, 0)
-	for _, tweet := range twitterResp.Data {
-		author := models.Author{
-			ID: tweet.AuthorID,
+	for _, data := range twitterResp.Data {
+		tweet := resolve(data)
+		bookmark := models.Bookmark{
+			ID:               tweet.ID,
+			TweetID:          tweet.ID,
+			Text:             tweet.Text,
+			CreatedAt:        tweet.CreatedAt,
+			Lang:             tweet.Lang,
+			ConversationID:   tweet.ConversationID,
+			Author:           tweet.Author,
+			PublicMetrics:    tweet.PublicMetrics,
+			Entities:         tweet.Entities,
+			Attachments:      tweet.Attachments,
+			Media:            tweet.Media,
+			ReferencedTweets: tweet.ReferencedTweets,
+			Bookmarked:       true,
 		}
-		if userData, ok := userMap[tweet.AuthorID]; ok {
-			author.Username = userData.Username
-			author.Name = userData.Name
+
+		// referenced tweets that are deleted or protected are missing from the includes
+		for _, ref := range tweet.ReferencedTweets {
+			referenced, ok := tweetMap[ref.ID]
+			if !ok {
+				continue
+			}
+
+			switch ref.Type {
+			case models.ReferenceQuoted:
+				bookmark.QuotedTweet = &referenced
+			case models.ReferenceRepliedTo:
+				bookmark.InReplyTo = &referenced
+			case models.ReferenceRetweeted:
+				bookmark.RetweetOf = &referenced
+			}
 		}
 
-		bookmarks = append(bookmarks, models.Bookmark{
-			ID:        tweet.ID,
-			TweetID:   tweet.ID,
-			Text:      tweet.Text,
-			CreatedAt: tweet.CreatedAt,
-			Author:    author,
-		})
+		bookmarks = append(bookmarks, bookmark)
 	}
 
 	return &models.BookmarkResponse{
-		Bookmarks: bookmarks,
-		NextToken: twitterResp.Meta.NextToken,
+		Bookmarks:  bookmarks,
+		NextCursor: twitterResp.Meta.NextToken,
 	}, nil
 }
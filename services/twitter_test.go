@@ -0,0 +1,569 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/services/twittertest"
+	"twitter-bookmarks/store"
+)
+
+// authorize visits the authorize URL on behalf of the account logging in on the fake and returns
+// the query of the redirect to the callback
+func authorize(t *testing.T, authorizeURL string) url.Values {
+	t.Helper()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(authorizeURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return location.Query()
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEnv(t)
+	e.fake.AddUser(models.User{ID: "2", Username: "other", Name: "Other"})
+	e.fake.LoginAs("2")
+
+	verifier, err := GenerateCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback := authorize(t, e.twitter.AuthorizeURL("state", GenerateCodeChallenge(verifier)))
+	if got := callback.Get("state"); got != "state" {
+		t.Errorf("state = %q, want %q", got, "state")
+	}
+
+	user, err := e.twitter.Authenticate(ctx, callback.Get("code"), verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "2" || user.Username != "other" {
+		t.Errorf("user = %+v, want account 2", user)
+	}
+
+	if _, err := e.store.LoadToken(ctx, "2"); err != nil {
+		t.Errorf("token not saved: %v", err)
+	}
+	if _, err := e.twitter.User(ctx, "2"); err != nil {
+		t.Errorf("user not saved: %v", err)
+	}
+}
+
+func TestAuthenticateWrongVerifier(t *testing.T) {
+	e := newTestEnv(t)
+
+	verifier, err := GenerateCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback := authorize(t, e.twitter.AuthorizeURL("state", GenerateCodeChallenge(verifier)))
+
+	_, err = e.twitter.Authenticate(context.Background(), callback.Get("code"), verifier+"x")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Title != "invalid_grant" {
+		t.Fatalf("err = %v, want invalid_grant", err)
+	}
+}
+
+func TestGetAllBookmarks(t *testing.T) {
+	e := newTestEnv(t)
+	bookmarks := twittertest.Bookmarks(1, 250)
+	e.fake.AddBookmarks(testUserID, bookmarks...)
+
+	got, err := e.twitter.GetAllBookmarks(context.Background(), testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(tweetIDs(got), tweetIDs(bookmarks)) {
+		t.Errorf("bookmarks = %v, want %v", tweetIDs(got), tweetIDs(bookmarks))
+	}
+	if n := e.requests(twittertest.BookmarksEndpoint); n != 3 {
+		t.Errorf("requested %d pages, want 3", n)
+	}
+}
+
+// countingTransport counts the requests it sends
+type countingTransport struct {
+	mu       sync.Mutex
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests++
+	c.mu.Unlock()
+
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		options func(client *http.Client, transport http.RoundTripper) []Options
+	}{
+		{"transport last", func(client *http.Client, transport http.RoundTripper) []Options {
+			return []Options{WithHTTPClient(client), WithTransport(transport)}
+		}},
+		{"client last", func(client *http.Client, transport http.RoundTripper) []Options {
+			return []Options{WithTransport(transport), WithHTTPClient(client)}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Timeout: time.Minute}
+			transport := &countingTransport{}
+			e := newTestEnv(t, tt.options(client, transport)...)
+			e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 10)...)
+
+			if _, err := e.twitter.GetAllBookmarks(context.Background(), testUserID); err != nil {
+				t.Fatal(err)
+			}
+			if transport.requests != 1 {
+				t.Errorf("transport sent %d requests, want 1", transport.requests)
+			}
+			if e.twitter.client.Timeout != time.Minute || client.Transport != nil {
+				t.Errorf("client = %+v, want a copy of the given client", e.twitter.client)
+			}
+		})
+	}
+}
+
+func TestBookmarkPages(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEnv(t)
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 5)...)
+
+	pages := e.twitter.BookmarkPages(testUserID, PageOptions{Limit: 2})
+
+	var got [][]string
+	for {
+		page, err := pages.Next(ctx)
+		if errors.Is(err, ErrNoMorePages) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, tweetIDs(page.Bookmarks))
+	}
+
+	want := [][]string{{"1", "2"}, {"3", "4"}, {"5"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pages = %v, want %v", got, want)
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEnv(t)
+	e.fake.RateLimit = 10
+	e.fake.FailNext(twittertest.BookmarksEndpoint, http.StatusTooManyRequests, 1)
+
+	_, err := e.twitter.GetBookmarks(ctx, testUserID, PageOptions{})
+
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("err = %v, want a RateLimitError", err)
+	}
+	if rateLimitErr.APIError == nil || rateLimitErr.APIError.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("APIError = %v, want the 429 response", rateLimitErr.APIError)
+	}
+	if rateLimitErr.RateLimit.Limit != 10 || rateLimitErr.RateLimit.Remaining != 9 {
+		t.Errorf("RateLimit = %+v, want limit 10 and 9 remaining", rateLimitErr.RateLimit)
+	}
+	// the window resets in 15 minutes, longer than the policy waits
+	if rateLimitErr.RetryAfter < 14*time.Minute {
+		t.Errorf("RetryAfter = %s, want the rate limit reset", rateLimitErr.RetryAfter)
+	}
+
+	limits := e.twitter.RateLimits(testUserID)
+	if len(limits) != 1 || limits[0].Endpoint != bookmarksEndpoint || limits[0].Remaining != 9 {
+		t.Errorf("RateLimits = %+v, want the bookmarks rate limit", limits)
+	}
+}
+
+func TestRateLimitExhausted(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEnv(t)
+	e.fake.RateLimit = 1
+
+	if _, err := e.twitter.GetBookmarks(ctx, testUserID, PageOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := e.twitter.GetBookmarks(ctx, testUserID, PageOptions{})
+
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("err = %v, want a RateLimitError", err)
+	}
+	if rateLimitErr.APIError != nil {
+		t.Errorf("APIError = %v, want the request not sent", rateLimitErr.APIError)
+	}
+	if n := e.requests(twittertest.BookmarksEndpoint); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestServerErrorRetried(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("recovered", func(t *testing.T) {
+		e := newTestEnv(t)
+		e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 1)...)
+		e.fake.FailNext(twittertest.BookmarksEndpoint, http.StatusServiceUnavailable, 2)
+
+		page, err := e.twitter.GetBookmarks(ctx, testUserID, PageOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Bookmarks) != 1 {
+			t.Errorf("got %d bookmarks, want 1", len(page.Bookmarks))
+		}
+		if n := e.requests(twittertest.BookmarksEndpoint); n != 3 {
+			t.Errorf("sent %d requests, want 3", n)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		e := newTestEnv(t)
+		e.fake.FailNext(twittertest.BookmarksEndpoint, http.StatusServiceUnavailable, 4)
+
+		_, err := e.twitter.GetBookmarks(ctx, testUserID, PageOptions{})
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("err = %v, want a 503 APIError", err)
+		}
+		if n := e.requests(twittertest.BookmarksEndpoint); n != 4 {
+			t.Errorf("sent %d requests, want 4", n)
+		}
+	})
+}
+
+func TestExpiredTokenRefreshed(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEnv(t)
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 1)...)
+
+	before, err := e.store.LoadToken(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stored token still looks valid, it is refreshed once the API rejects it
+	e.fake.ExpireTokens()
+
+	if _, err := e.twitter.GetBookmarks(ctx, testUserID, PageOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := e.store.LoadToken(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.AccessToken == before.AccessToken || after.RefreshToken == before.RefreshToken {
+		t.Error("token not refreshed")
+	}
+	if n := e.requests(twittertest.TokenEndpoint); n != 1 {
+		t.Errorf("refreshed %d times, want 1", n)
+	}
+	if n := e.requests(twittertest.BookmarksEndpoint); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+}
+
+func TestExpiringTokenRefreshed(t *testing.T) {
+	ctx := context.Background()
+	later := time.Now().Add(3 * time.Hour)
+	e := newTestEnv(t, WithClock(func() time.Time { return later }))
+	e.fake.Now = func() time.Time { return later }
+	e.fake.AddBookmarks(testUserID, twittertest.Bookmarks(1, 1)...)
+
+	// the stored token expired, it is refreshed before sending the request
+	if _, err := e.twitter.GetBookmarks(ctx, testUserID, PageOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := e.requests(twittertest.TokenEndpoint); n != 1 {
+		t.Errorf("refreshed %d times, want 1", n)
+	}
+	if n := e.requests(twittertest.BookmarksEndpoint); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+
+	token, err := e.store.LoadToken(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.Expiry.After(later) {
+		t.Errorf("expiry = %s, want after %s", token.Expiry, later)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("revoked", func(t *testing.T) {
+		e := newTestEnv(t)
+
+		if err := e.twitter.Revoke(ctx, testUserID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := e.twitter.User(ctx, testUserID); !errors.Is(err, ErrNotAuthenticated) {
+			t.Errorf("User err = %v, want ErrNotAuthenticated", err)
+		}
+		if _, err := e.twitter.GetBookmarks(ctx, testUserID, PageOptions{}); !errors.Is(err, ErrNotAuthenticated) {
+			t.Errorf("GetBookmarks err = %v, want ErrNotAuthenticated", err)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		e := newTestEnv(t)
+		e.fake.FailNext(twittertest.RevokeEndpoint, http.StatusServiceUnavailable, 1)
+
+		if err := e.twitter.Revoke(ctx, testUserID); err == nil {
+			t.Fatal("Revoke succeeded, want an error")
+		}
+
+		// the account is kept so revoking can be retried
+		if _, err := e.twitter.User(ctx, testUserID); err != nil {
+			t.Errorf("User err = %v, want the account kept", err)
+		}
+		if _, err := e.store.LoadToken(ctx, testUserID); err != nil {
+			t.Errorf("LoadToken err = %v, want the token kept", err)
+		}
+	})
+
+	t.Run("refresh token revoked", func(t *testing.T) {
+		e := newTestEnv(t)
+		token, err := e.store.LoadToken(ctx, testUserID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := e.twitter.Revoke(ctx, testUserID); err != nil {
+			t.Fatal(err)
+		}
+
+		if e.fake.ValidToken(token.AccessToken) || e.fake.ValidToken(token.RefreshToken) {
+			t.Error("tokens still valid on Twitter")
+		}
+		if n := e.requests(twittertest.RevokeEndpoint); n != 2 {
+			t.Errorf("sent %d revocations, want the refresh and access tokens revoked", n)
+		}
+	})
+
+	tests := []struct {
+		name        string
+		code        string
+		description string
+		revoked     bool
+	}{
+		{"invalid token", "invalid_token", "The token is invalid", true},
+		{"unknown token", "invalid_request", "Value passed for the token was invalid.", true},
+		{"invalid request", "invalid_request", "Missing required parameter [token].", false},
+		{"invalid client", "invalid_client", "Missing valid authorization header", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEnv(t)
+			e.fake.FailNextOAuth(twittertest.RevokeEndpoint, tt.code, tt.description, 2)
+
+			err := e.twitter.Revoke(ctx, testUserID)
+
+			_, userErr := e.store.GetUser(ctx, testUserID)
+			if tt.revoked {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !errors.Is(userErr, store.ErrNotFound) {
+					t.Errorf("GetUser err = %v, want the account removed", userErr)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("Revoke succeeded, want an error")
+			}
+			if userErr != nil {
+				t.Errorf("GetUser err = %v, want the account kept", userErr)
+			}
+		})
+	}
+
+	t.Run("unauthorized client", func(t *testing.T) {
+		e := newTestEnv(t)
+		e.fake.FailNext(twittertest.RevokeEndpoint, http.StatusUnauthorized, 1)
+
+		if err := e.twitter.Revoke(ctx, testUserID); err == nil {
+			t.Fatal("Revoke succeeded, want an error")
+		}
+		if _, err := e.store.LoadToken(ctx, testUserID); err != nil {
+			t.Errorf("LoadToken err = %v, want the token kept", err)
+		}
+	})
+}
+
+// getBookmarks returns the first page of bookmarks of the test account
+func (e *testEnv) getBookmarks(t *testing.T) map[string]models.Bookmark {
+	t.Helper()
+
+	response, err := e.twitter.GetBookmarks(context.Background(), testUserID, PageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bookmarks := make(map[string]models.Bookmark, len(response.Bookmarks))
+	for _, bookmark := range response.Bookmarks {
+		bookmarks[bookmark.TweetID] = bookmark
+	}
+
+	return bookmarks
+}
+
+func TestGetBookmarksReferencedTweets(t *testing.T) {
+	e := newTestEnv(t)
+
+	quoted := models.Tweet{
+		ID:          "900",
+		Text:        "the quoted tweet",
+		Author:      models.Author{ID: "300", Username: "quoted", Name: "Quoted"},
+		Attachments: models.Attachments{MediaKeys: []string{"3_900"}},
+		Media:       []models.Media{{MediaKey: "3_900", Type: "photo", URL: "https://pbs.twimg.com/media/quoted.jpg"}},
+	}
+	original := models.Tweet{ID: "901", Text: "the retweeted tweet", Author: models.Author{ID: "301", Username: "original"}}
+
+	bookmarks := twittertest.Bookmarks(1, 4)
+	bookmarks[0].QuotedTweet = &quoted
+	bookmarks[1].RetweetOf = &original
+	bookmarks[1].InReplyTo = &quoted
+	// the replied tweet of 3 is deleted or protected, it is missing from the includes
+	bookmarks[2].ReferencedTweets = []models.ReferencedTweet{{Type: models.ReferenceRepliedTo, ID: "999"}}
+	e.fake.AddBookmarks(testUserID, bookmarks...)
+
+	got := e.getBookmarks(t)
+	if len(got) != 4 {
+		t.Fatalf("got %d bookmarks, want the whole page", len(got))
+	}
+
+	if q := got["1"].QuotedTweet; q == nil || q.Author != quoted.Author || !reflect.DeepEqual(q.Media, quoted.Media) {
+		t.Errorf("quoted tweet = %+v, want %+v with its author and media", q, quoted)
+	}
+	if got["1"].InReplyTo != nil || got["1"].RetweetOf != nil {
+		t.Errorf("bookmark 1 = %+v, want only a quoted tweet", got["1"])
+	}
+
+	if r := got["2"].RetweetOf; r == nil || r.ID != original.ID || r.Author.Username != "original" {
+		t.Errorf("retweeted tweet = %+v, want %+v", r, original)
+	}
+	if r := got["2"].InReplyTo; r == nil || r.ID != quoted.ID || r.Author != quoted.Author {
+		t.Errorf("replied tweet = %+v, want %+v", r, quoted)
+	}
+
+	missing := got["3"]
+	if missing.InReplyTo != nil {
+		t.Errorf("replied tweet = %+v, want nil for a tweet missing from the includes", missing.InReplyTo)
+	}
+	if want := []models.ReferencedTweet{{Type: models.ReferenceRepliedTo, ID: "999"}}; !reflect.DeepEqual(missing.ReferencedTweets, want) {
+		t.Errorf("references = %+v, want %+v", missing.ReferencedTweets, want)
+	}
+
+	if b := got["4"]; b.QuotedTweet != nil || b.InReplyTo != nil || b.RetweetOf != nil {
+		t.Errorf("bookmark 4 = %+v, want no referenced tweet", b)
+	}
+}
+
+func TestGetBookmarksMedia(t *testing.T) {
+	e := newTestEnv(t)
+
+	photo := models.Media{MediaKey: "3_1", Type: "photo", URL: "https://pbs.twimg.com/media/1.jpg", Width: 800, Height: 600, AltText: "a gopher"}
+	video := models.Media{
+		MediaKey:        "7_2",
+		Type:            "video",
+		PreviewImageURL: "https://pbs.twimg.com/preview/2.jpg",
+		DurationMS:      12500,
+		AltText:         "a running gopher",
+		Variants: []models.MediaVariant{
+			{ContentType: "application/x-mpegURL", URL: "https://video.twimg.com/2.m3u8"},
+			{BitRate: 832000, ContentType: "video/mp4", URL: "https://video.twimg.com/2.mp4"},
+		},
+	}
+
+	bookmarks := twittertest.Bookmarks(1, 1)
+	// the includes list the photo first, the tweet attaches the video first and a media Twitter
+	// did not return
+	bookmarks[0].Attachments.MediaKeys = []string{"7_2", "16_404", "3_1"}
+	bookmarks[0].Media = []models.Media{photo, video}
+	e.fake.AddBookmarks(testUserID, bookmarks...)
+
+	got := e.getBookmarks(t)["1"]
+
+	if want := []models.Media{video, photo}; !reflect.DeepEqual(got.Media, want) {
+		t.Errorf("media = %+v, want %+v", got.Media, want)
+	}
+	if want := []string{"7_2", "16_404", "3_1"}; !reflect.DeepEqual(got.Attachments.MediaKeys, want) {
+		t.Errorf("media keys = %v, want %v", got.Attachments.MediaKeys, want)
+	}
+}
+
+func TestGetBookmarksEntities(t *testing.T) {
+	e := newTestEnv(t)
+	e.fake.AddUser(models.User{ID: "200", Username: "Gopher", Name: "Gopher"})
+
+	entities := models.Entities{
+		URLs: []models.URLEntity{
+			{Start: 0, End: 23, URL: "https://t.co/a", ExpandedURL: "https://bit.ly/go", DisplayURL: "bit.ly/go",
+				UnwoundURL: "https://go.dev/blog", Title: "The Go Blog", Description: "News of Go"},
+			{Start: 24, End: 47, URL: "https://t.co/b", ExpandedURL: "https://pkg.go.dev", DisplayURL: "pkg.go.dev"},
+		},
+		Hashtags: []models.HashtagEntity{{Start: 48, End: 55, Tag: "golang"}},
+		Mentions: []models.MentionEntity{
+			{Start: 56, End: 63, Username: "gopher"},
+			{Start: 64, End: 72, Username: "stranger"},
+			{Start: 73, End: 80, Username: "rustacean", ID: "300"},
+		},
+		Cashtags: []models.CashtagEntity{{Start: 81, End: 86, Tag: "GOOG"}},
+	}
+
+	bookmarks := twittertest.Bookmarks(1, 1)
+	bookmarks[0].Entities = entities
+	e.fake.AddBookmarks(testUserID, bookmarks...)
+
+	got := e.getBookmarks(t)["1"].Entities
+
+	// the mention of a user in the includes gets its ID, unknown users keep none
+	entities.Mentions[0].ID = "200"
+	if !reflect.DeepEqual(got, entities) {
+		t.Errorf("entities = %+v, want %+v", got, entities)
+	}
+}
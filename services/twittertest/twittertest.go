@@ -0,0 +1,845 @@
+// Package twittertest provides an in-process fake of the Twitter API for tests.
+//
+// The fake implements the OAuth2 authorize, token and revoke endpoints, /2/users/me,
+// /2/users/:id/bookmarks, /2/tweets and /2/tweets/search/recent. Point a services.TwitterService at it with
+// services.WithBaseURL(server.URL) and services.WithAuthBaseURL(server.URL), and seed its account store
+// with ConnectUser.
+package twittertest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+	"twitter-bookmarks/store"
+)
+
+// Endpoints identify the rate limit buckets and the targets of injected errors
+const (
+	TokenEndpoint     = "POST /2/oauth2/token"
+	RevokeEndpoint    = "POST /2/oauth2/revoke"
+	MeEndpoint        = "GET /2/users/me"
+	BookmarksEndpoint = "GET /2/users/:id/bookmarks"
+	TweetsEndpoint    = "GET /2/tweets"
+	SearchEndpoint    = "GET /2/tweets/search/recent"
+)
+
+// Request is a request received by the server
+type Request struct {
+	Endpoint string
+	URL      *url.URL
+	UserID   string
+}
+
+// Server is a fake Twitter API listening on a local address
+type Server struct {
+	*httptest.Server
+
+	mu sync.Mutex
+
+	// Now tells the current time of the server, it defaults to time.Now
+	Now func() time.Time
+	// TokenTTL is the lifetime of issued access tokens
+	TokenTTL time.Duration
+	// RateLimit is the number of requests allowed per endpoint, account and window, 0 disables rate limiting
+	RateLimit int
+	// RateLimitWindow is the duration of a rate limit window
+	RateLimitWindow time.Duration
+
+	users      map[string]models.User
+	bookmarks  map[string][]models.Bookmark
+	tweets     map[string]models.Tweet
+	loginUser  string
+	codes      map[string]authorization
+	tokens     map[string]token
+	refreshes  map[string]string
+	windows    map[string]*window
+	failures   map[string][]failure
+	requests   []Request
+	tokenCount int
+}
+
+type authorization struct {
+	userID        string
+	codeChallenge string
+	redirectURI   string
+}
+
+type token struct {
+	userID string
+	expiry time.Time
+}
+
+type window struct {
+	remaining int
+	reset     time.Time
+}
+
+type failure struct {
+	status int
+	// body is a problem, or an OAuth2 error for the OAuth2 endpoints
+	body interface{}
+}
+
+type problem struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Type   string `json:"type"`
+	Status int    `json:"status"`
+}
+
+// NewServer starts a fake Twitter API, it must be closed when done
+func NewServer() *Server {
+	s := &Server{
+		Now:             time.Now,
+		TokenTTL:        2 * time.Hour,
+		RateLimitWindow: 15 * time.Minute,
+		users:           make(map[string]models.User),
+		bookmarks:       make(map[string][]models.Bookmark),
+		tweets:          make(map[string]models.Tweet),
+		codes:           make(map[string]authorization),
+		tokens:          make(map[string]token),
+		refreshes:       make(map[string]string),
+		windows:         make(map[string]*window),
+		failures:        make(map[string][]failure),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// AddUser registers an account, the first account added is the one logging in on the authorize page
+func (s *Server) AddUser(user models.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.ID] = user
+	if s.loginUser == "" {
+		s.loginUser = user.ID
+	}
+}
+
+// LoginAs selects the account logging in on the authorize page
+func (s *Server) LoginAs(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loginUser = userID
+}
+
+// AddBookmarks appends bookmarks to an account, the most recent bookmark first.
+// The authors of the bookmarks are returned in the users expansion and their media in the media expansion.
+func (s *Server) AddBookmarks(userID string, bookmarks ...models.Bookmark) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bookmarks[userID] = append(s.bookmarks[userID], bookmarks...)
+}
+
+// AddTweets publishes tweets, they are returned by the tweet lookup and the recent search
+func (s *Server) AddTweets(tweets ...models.Tweet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tweet := range tweets {
+		s.tweets[tweet.ID] = tweet
+	}
+}
+
+// PrependBookmarks adds bookmarks before the existing ones, as if they were just bookmarked
+func (s *Server) PrependBookmarks(userID string, bookmarks ...models.Bookmark) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bookmarks[userID] = append(append([]models.Bookmark{}, bookmarks...), s.bookmarks[userID]...)
+}
+
+// RemoveBookmark removes a tweet from the bookmarks of an account
+func (s *Server) RemoveBookmark(userID, tweetID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bookmarks := s.bookmarks[userID][:0]
+	for _, bookmark := range s.bookmarks[userID] {
+		if bookmark.TweetID != tweetID {
+			bookmarks = append(bookmarks, bookmark)
+		}
+	}
+	s.bookmarks[userID] = bookmarks
+}
+
+// IssueToken returns a valid access token and refresh token for an account without going through the authorize page
+func (s *Server) IssueToken(userID string) (accessToken, refreshToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.issueToken(userID)
+}
+
+// ConnectUser adds an account and saves it into accounts along with a valid token, as if it had
+// gone through the authorization flow
+func (s *Server) ConnectUser(t testing.TB, accounts store.AccountStore, user models.User) {
+	t.Helper()
+	ctx := context.Background()
+
+	s.AddUser(user)
+	if err := accounts.SaveUser(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+
+	accessToken, refreshToken := s.IssueToken(user.ID)
+	token := &models.Token{AccessToken: accessToken, RefreshToken: refreshToken, Expiry: s.Now().Add(s.TokenTTL)}
+	if err := accounts.SaveToken(ctx, user.ID, token); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ExpireTokens expires every access token issued so far, refresh tokens stay valid
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, t := range s.tokens {
+		t.expiry = time.Time{}
+		s.tokens[k] = t
+	}
+}
+
+// FailNext makes the next count requests to endpoint fail with status and a problem body
+func (s *Server) FailNext(endpoint string, status, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < count; i++ {
+		s.failures[endpoint] = append(s.failures[endpoint], failure{
+			status: status,
+			body: problem{
+				Title:  http.StatusText(status),
+				Detail: "injected error",
+				Type:   "about:blank",
+				Status: status,
+			},
+		})
+	}
+}
+
+// FailNextOAuth makes the next count requests to an OAuth2 endpoint fail with a 400 OAuth2 error
+// such as invalid_token, described by description
+func (s *Server) FailNextOAuth(endpoint, code, description string, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < count; i++ {
+		s.failures[endpoint] = append(s.failures[endpoint], failure{
+			status: http.StatusBadRequest,
+			body:   map[string]string{"error": code, "error_description": description},
+		})
+	}
+}
+
+// ValidToken tells whether an access or refresh token was issued and not revoked, access tokens
+// are valid until they are revoked even once expired
+func (s *Server) ValidToken(value string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, access := s.tokens[value]
+	_, refresh := s.refreshes[value]
+
+	return access || refresh
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request{}, s.requests...)
+}
+
+// Bookmarks returns n bookmarks of a single author with tweet IDs counting from first, the most
+// recent first
+func Bookmarks(first, n int) []models.Bookmark {
+	author := models.Author{ID: "100", Username: "author", Name: "Author"}
+
+	bookmarks := make([]models.Bookmark, 0, n)
+	for id := first; id < first+n; id++ {
+		bookmarks = append(bookmarks, models.Bookmark{
+			ID:        strconv.Itoa(id),
+			TweetID:   strconv.Itoa(id),
+			Text:      fmt.Sprintf("tweet %d", id),
+			CreatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).Add(-time.Duration(id) * time.Minute),
+			Author:    author,
+		})
+	}
+
+	return bookmarks
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/i/oauth2/authorize":
+		s.authorize(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/2/oauth2/token":
+		s.serveEndpoint(w, r, TokenEndpoint, "", s.token)
+	case r.Method == http.MethodPost && r.URL.Path == "/2/oauth2/revoke":
+		s.serveEndpoint(w, r, RevokeEndpoint, "", s.revoke)
+	case r.Method == http.MethodGet && r.URL.Path == "/2/users/me":
+		s.serveAuthorized(w, r, MeEndpoint, s.me)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/2/users/") && strings.HasSuffix(r.URL.Path, "/bookmarks"):
+		s.serveAuthorized(w, r, BookmarksEndpoint, s.listBookmarks)
+	case r.Method == http.MethodGet && r.URL.Path == "/2/tweets":
+		s.serveAuthorized(w, r, TweetsEndpoint, s.lookupTweets)
+	case r.Method == http.MethodGet && r.URL.Path == "/2/tweets/search/recent":
+		s.serveAuthorized(w, r, SearchEndpoint, s.searchTweets)
+	default:
+		writeProblem(w, http.StatusNotFound, "Not Found", "unknown endpoint "+r.Method+" "+r.URL.Path)
+	}
+}
+
+// serveAuthorized checks the bearer token before serving an endpoint on behalf of its account
+func (s *Server) serveAuthorized(w http.ResponseWriter, r *http.Request, endpoint string, handler func(w http.ResponseWriter, r *http.Request, userID string)) {
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	t, ok := s.tokens[accessToken]
+	if !ok || !s.Now().Before(t.expiry) {
+		s.requests = append(s.requests, Request{Endpoint: endpoint, URL: r.URL})
+		writeProblem(w, http.StatusUnauthorized, "Unauthorized", "invalid or expired access token")
+		return
+	}
+
+	s.serveEndpoint(w, r, endpoint, t.userID, func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, t.userID)
+	})
+}
+
+// serveEndpoint records the request, applies the rate limit and injected errors, then serves it
+func (s *Server) serveEndpoint(w http.ResponseWriter, r *http.Request, endpoint, userID string, handler http.HandlerFunc) {
+	s.requests = append(s.requests, Request{Endpoint: endpoint, URL: r.URL, UserID: userID})
+
+	if s.RateLimit > 0 && userID != "" {
+		now := s.Now()
+		key := userID + " " + endpoint
+
+		win, ok := s.windows[key]
+		if !ok || !now.Before(win.reset) {
+			win = &window{remaining: s.RateLimit, reset: now.Add(s.RateLimitWindow)}
+			s.windows[key] = win
+		}
+
+		exhausted := win.remaining == 0
+		if !exhausted {
+			win.remaining--
+		}
+
+		w.Header().Set("x-rate-limit-limit", strconv.Itoa(s.RateLimit))
+		w.Header().Set("x-rate-limit-remaining", strconv.Itoa(win.remaining))
+		w.Header().Set("x-rate-limit-reset", strconv.FormatInt(win.reset.Unix(), 10))
+
+		if exhausted {
+			writeProblem(w, http.StatusTooManyRequests, "Too Many Requests", "Too Many Requests")
+			return
+		}
+	}
+
+	if failures := s.failures[endpoint]; len(failures) > 0 {
+		s.failures[endpoint] = failures[1:]
+		writeJSON(w, failures[0].status, failures[0].body)
+		return
+	}
+
+	handler(w, r)
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		writeProblem(w, http.StatusBadRequest, "invalid_request", "S256 code challenge required")
+		return
+	}
+
+	if _, ok := s.users[s.loginUser]; !ok {
+		writeProblem(w, http.StatusBadRequest, "invalid_request", "no account to log in with")
+		return
+	}
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.String() == "" {
+		writeProblem(w, http.StatusBadRequest, "invalid_request", "invalid redirect_uri")
+		return
+	}
+
+	code := randomString()
+	s.codes[code] = authorization{
+		userID:        s.loginUser,
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   redirect.String(),
+	}
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirect.RawQuery = params.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, "invalid_request", err.Error())
+		return
+	}
+
+	var userID string
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		auth, ok := s.codes[r.PostForm.Get("code")]
+		if !ok {
+			writeOAuthError(w, "invalid_grant", "unknown authorization code")
+			return
+		}
+		delete(s.codes, r.PostForm.Get("code"))
+
+		hash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(hash[:]) != auth.codeChallenge {
+			writeOAuthError(w, "invalid_grant", "code verifier does not match the code challenge")
+			return
+		}
+
+		if r.PostForm.Get("redirect_uri") != auth.redirectURI {
+			writeOAuthError(w, "invalid_grant", "redirect_uri does not match the authorization request")
+			return
+		}
+
+		userID = auth.userID
+	case "refresh_token":
+		var ok bool
+		userID, ok = s.refreshes[r.PostForm.Get("refresh_token")]
+		if !ok {
+			writeOAuthError(w, "invalid_grant", "unknown refresh token")
+			return
+		}
+		// refresh tokens can only be used once
+		delete(s.refreshes, r.PostForm.Get("refresh_token"))
+	default:
+		writeOAuthError(w, "unsupported_grant_type", "unsupported grant type")
+		return
+	}
+
+	accessToken, refreshToken := s.issueToken(userID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token_type":    "bearer",
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(s.TokenTTL.Seconds()),
+		"scope":         "tweet.read users.read bookmark.read offline.access",
+	})
+}
+
+func (s *Server) issueToken(userID string) (accessToken, refreshToken string) {
+	s.tokenCount++
+	accessToken = fmt.Sprintf("access-%d-%s", s.tokenCount, randomString())
+	refreshToken = fmt.Sprintf("refresh-%d-%s", s.tokenCount, randomString())
+
+	s.tokens[accessToken] = token{userID: userID, expiry: s.Now().Add(s.TokenTTL)}
+	s.refreshes[refreshToken] = userID
+
+	return accessToken, refreshToken
+}
+
+func (s *Server) revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, "invalid_request", err.Error())
+		return
+	}
+
+	value := r.PostForm.Get("token")
+	delete(s.tokens, value)
+
+	// revoking a refresh token also revokes the access tokens of its account
+	if userID, ok := s.refreshes[value]; ok {
+		delete(s.refreshes, value)
+		for k, t := range s.tokens {
+			if t.userID == userID {
+				delete(s.tokens, k)
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"revoked": true})
+}
+
+func (s *Server) me(w http.ResponseWriter, r *http.Request, userID string) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": s.users[userID]})
+}
+
+func (s *Server) listBookmarks(w http.ResponseWriter, r *http.Request, userID string) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/2/users/"), "/bookmarks")
+	if id != userID {
+		writeProblem(w, http.StatusForbidden, "Forbidden", "the access token does not belong to user "+id)
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit := 100
+	if value := query.Get("max_results"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			writeProblem(w, http.StatusBadRequest, "Invalid Request", "max_results must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	offset := 0
+	if value := query.Get("pagination_token"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeProblem(w, http.StatusBadRequest, "Invalid Request", "invalid pagination_token")
+			return
+		}
+		offset = n
+	}
+
+	bookmarks := s.bookmarks[userID]
+	if offset > len(bookmarks) {
+		offset = len(bookmarks)
+	}
+	end := offset + limit
+	if end > len(bookmarks) {
+		end = len(bookmarks)
+	}
+	page := bookmarks[offset:end]
+
+	meta := map[string]interface{}{"result_count": len(page)}
+	if end < len(bookmarks) {
+		meta["next_token"] = strconv.Itoa(end)
+	}
+
+	response := s.tweetsResponse(page, query)
+	response["meta"] = meta
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// lookupTweets serves the tweets added with AddTweets and the bookmarked tweets, unknown IDs are
+// reported in errors
+func (s *Server) lookupTweets(w http.ResponseWriter, r *http.Request, userID string) {
+	query := r.URL.Query()
+
+	var (
+		found   []models.Bookmark
+		missing []map[string]string
+	)
+	for _, id := range strings.Split(query.Get("ids"), ",") {
+		if tweet, ok := s.tweet(id); ok {
+			found = append(found, tweet)
+		} else {
+			missing = append(missing, map[string]string{"value": id, "title": "Not Found Error", "detail": "Could not find tweet with ids: [" + id + "]."})
+		}
+	}
+
+	response := s.tweetsResponse(found, query)
+	if len(missing) > 0 {
+		response["errors"] = missing
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// searchTweets serves the tweets added with AddTweets matching a query made of conversation_id:
+// and from: operators, most recent first. Unlike Twitter it searches tweets of any age.
+func (s *Server) searchTweets(w http.ResponseWriter, r *http.Request, userID string) {
+	query := r.URL.Query()
+
+	var conversationID, from string
+	for _, term := range strings.Fields(query.Get("query")) {
+		name, value, _ := strings.Cut(term, ":")
+		switch name {
+		case "conversation_id":
+			conversationID = value
+		case "from":
+			from = value
+		default:
+			writeProblem(w, http.StatusBadRequest, "Invalid Request", "unsupported query term "+term)
+			return
+		}
+	}
+
+	limit := 10
+	if value := query.Get("max_results"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 10 || n > 100 {
+			writeProblem(w, http.StatusBadRequest, "Invalid Request", "max_results must be between 10 and 100")
+			return
+		}
+		limit = n
+	}
+
+	offset := 0
+	if value := query.Get("next_token"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeProblem(w, http.StatusBadRequest, "Invalid Request", "invalid next_token")
+			return
+		}
+		offset = n
+	}
+
+	var matches []models.Bookmark
+	for _, tweet := range s.tweets {
+		if conversationID != "" && tweet.ConversationID != conversationID {
+			continue
+		}
+		if from != "" && tweet.Author.ID != from && !strings.EqualFold(tweet.Author.Username, from) {
+			continue
+		}
+		matches = append(matches, tweetBookmark(tweet))
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].CreatedAt.After(matches[j].CreatedAt) })
+
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+	end := offset + limit
+	if end > len(matches) {
+		end = len(matches)
+	}
+	page := matches[offset:end]
+
+	meta := map[string]interface{}{"result_count": len(page)}
+	if end < len(matches) {
+		meta["next_token"] = strconv.Itoa(end)
+	}
+
+	response := s.tweetsResponse(page, query)
+	response["meta"] = meta
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// tweet returns a tweet added with AddTweets or bookmarked by an account
+func (s *Server) tweet(id string) (models.Bookmark, bool) {
+	if tweet, ok := s.tweets[id]; ok {
+		return tweetBookmark(tweet), true
+	}
+
+	for _, bookmarks := range s.bookmarks {
+		for _, bookmark := range bookmarks {
+			if bookmark.TweetID == id {
+				return bookmark, true
+			}
+		}
+	}
+
+	return models.Bookmark{}, false
+}
+
+// tweetsResponse encodes tweets the way the v2 API returns them, along with the expansions
+// requested in query
+func (s *Server) tweetsResponse(page []models.Bookmark, query url.Values) map[string]interface{} {
+	expansions := make(map[string]bool)
+	for _, expansion := range strings.Split(query.Get("expansions"), ",") {
+		expansions[expansion] = true
+	}
+	expandMentions, expandMedia := expansions["entities.mentions.username"], expansions["attachments.media_keys"]
+
+	data := make([]map[string]interface{}, 0, len(page))
+	authors := make(map[string]models.Author)
+	media := make([]models.Media, 0)
+	tweets := make([]map[string]interface{}, 0)
+	for _, bookmark := range page {
+		data = append(data, tweetJSON(bookmark))
+		if expandMedia {
+			media = append(media, bookmark.Media...)
+		}
+		if bookmark.Author.ID != "" {
+			authors[bookmark.Author.ID] = bookmark.Author
+		}
+
+		if expansions["referenced_tweets.id"] {
+			for _, tweet := range referencedTweets(bookmark) {
+				tweets = append(tweets, tweetJSON(tweetBookmark(*tweet)))
+				if expansions["referenced_tweets.id.attachments.media_keys"] {
+					media = append(media, tweet.Media...)
+				}
+				if expansions["referenced_tweets.id.author_id"] && tweet.Author.ID != "" {
+					authors[tweet.Author.ID] = tweet.Author
+				}
+			}
+		}
+
+		if expandMentions {
+			for _, mention := range bookmark.Entities.Mentions {
+				if user, ok := s.userByUsername(mention.Username); ok {
+					authors[user.ID] = models.Author{ID: user.ID, Username: user.Username, Name: user.Name}
+				}
+			}
+		}
+	}
+
+	users := make([]models.Author, 0, len(authors))
+	for _, author := range authors {
+		users = append(users, author)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	response := make(map[string]interface{})
+	if len(data) > 0 {
+		response["data"] = data
+		includes := map[string]interface{}{"users": users}
+		if len(media) > 0 {
+			includes["media"] = media
+		}
+		if len(tweets) > 0 {
+			includes["tweets"] = tweets
+		}
+		response["includes"] = includes
+	}
+
+	return response
+}
+
+// userByUsername returns the registered account with a username, mentioned accounts are returned
+// in the users expansion when they are registered
+func (s *Server) userByUsername(username string) (models.User, bool) {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Username, username) {
+			return user, true
+		}
+	}
+
+	return models.User{}, false
+}
+
+// referencedTweets returns the tweets quoted, replied to or retweeted by a bookmark
+func referencedTweets(bookmark models.Bookmark) map[string]*models.Tweet {
+	tweets := make(map[string]*models.Tweet)
+	for refType, tweet := range map[string]*models.Tweet{
+		models.ReferenceQuoted:    bookmark.QuotedTweet,
+		models.ReferenceRepliedTo: bookmark.InReplyTo,
+		models.ReferenceRetweeted: bookmark.RetweetOf,
+	} {
+		if tweet != nil {
+			tweets[refType] = tweet
+		}
+	}
+
+	return tweets
+}
+
+// tweetBookmark returns a bookmark of a referenced tweet, to encode it like the bookmarked tweets
+func tweetBookmark(tweet models.Tweet) models.Bookmark {
+	return models.Bookmark{
+		TweetID:          tweet.ID,
+		Text:             tweet.Text,
+		CreatedAt:        tweet.CreatedAt,
+		Lang:             tweet.Lang,
+		ConversationID:   tweet.ConversationID,
+		Author:           tweet.Author,
+		PublicMetrics:    tweet.PublicMetrics,
+		Entities:         tweet.Entities,
+		Attachments:      tweet.Attachments,
+		Media:            tweet.Media,
+		ReferencedTweets: tweet.ReferencedTweets,
+	}
+}
+
+// tweetJSON encodes a bookmark the way the v2 API returns tweets
+func tweetJSON(bookmark models.Bookmark) map[string]interface{} {
+	tweet := map[string]interface{}{
+		"id":             bookmark.TweetID,
+		"text":           bookmark.Text,
+		"public_metrics": bookmark.PublicMetrics,
+		"entities":       bookmark.Entities,
+		"attachments":    bookmark.Attachments,
+	}
+
+	// the media of a bookmark are attached to its tweet unless their keys are given
+	if len(bookmark.Attachments.MediaKeys) == 0 && len(bookmark.Media) > 0 {
+		attachments := bookmark.Attachments
+		for _, media := range bookmark.Media {
+			attachments.MediaKeys = append(attachments.MediaKeys, media.MediaKey)
+		}
+		tweet["attachments"] = attachments
+	}
+
+	// the referenced tweets of a bookmark are listed unless their references are given
+	references := bookmark.ReferencedTweets
+	if len(references) == 0 {
+		for refType, referenced := range referencedTweets(bookmark) {
+			references = append(references, models.ReferencedTweet{Type: refType, ID: referenced.ID})
+		}
+		sort.Slice(references, func(i, j int) bool { return references[i].Type < references[j].Type })
+	}
+	if len(references) > 0 {
+		tweet["referenced_tweets"] = references
+	}
+
+	if !bookmark.CreatedAt.IsZero() {
+		tweet["created_at"] = bookmark.CreatedAt.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+
+	if bookmark.Author.ID != "" {
+		tweet["author_id"] = bookmark.Author.ID
+	}
+
+	if bookmark.Lang != "" {
+		tweet["lang"] = bookmark.Lang
+	}
+
+	if bookmark.ConversationID != "" {
+		tweet["conversation_id"] = bookmark.ConversationID
+	}
+
+	return tweet
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeProblem(w http.ResponseWriter, status int, title, detail string) {
+	writeJSON(w, status, problem{
+		Title:  title,
+		Detail: detail,
+		Type:   "about:blank",
+		Status: status,
+	})
+}
+
+func writeOAuthError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"twitter-bookmarks/models"
+)
+
+// ErrInvalidAnnotation is returned when a note is too long or a highlight is out of the tweet text
+var ErrInvalidAnnotation = errors.New("invalid annotation")
+
+// maxNoteLength is the maximum number of characters of a note
+const maxNoteLength = 10000
+
+// NormalizeHighlights checks that highlights are spans of text, sorts them and fills their text
+func NormalizeHighlights(text string, highlights []models.Highlight) ([]models.Highlight, error) {
+	runes := []rune(text)
+
+	normalized := make([]models.Highlight, 0, len(highlights))
+	for _, highlight := range highlights {
+		if highlight.Start < 0 || highlight.End <= highlight.Start || highlight.End > len(runes) {
+			return nil, fmt.Errorf("%w: highlight [%d, %d) is out of the %d characters of the text",
+				ErrInvalidAnnotation, highlight.Start, highlight.End, len(runes))
+		}
+
+		highlight.Text = string(runes[highlight.Start:highlight.End])
+		normalized = append(normalized, highlight)
+	}
+
+	sort.Slice(normalized, func(i, j int) bool {
+		if normalized[i].Start != normalized[j].Start {
+			return normalized[i].Start < normalized[j].Start
+		}
+		return normalized[i].End < normalized[j].End
+	})
+
+	return normalized, nil
+}
+
+// AnnotateBookmark replaces the note and highlights of an archived bookmark, highlights must have
+// been normalized against the bookmark text
+func (s *SQLiteStore) AnnotateBookmark(ctx context.Context, userID, tweetID, note string, highlights []models.Highlight, now time.Time) error {
+	if utf8.RuneCountInString(note) > maxNoteLength {
+		return fmt.Errorf("%w: notes are limited to %d characters", ErrInvalidAnnotation, maxNoteLength)
+	}
+
+	if highlights == nil {
+		highlights = []models.Highlight{}
+	}
+
+	data, err := json.Marshal(highlights)
+	if err != nil {
+		return fmt.Errorf("failed to encode highlights: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, `UPDATE bookmarks SET note = ?, highlights = ?, annotated_at = ?
+		WHERE user_id = ? AND tweet_id = ?`, note, data, toUnix(now), userID, tweetID)
+	if err != nil {
+		return fmt.Errorf("failed to annotate bookmark: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to annotate bookmark: %w", err)
+	}
+
+	if updated == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
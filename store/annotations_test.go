@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+)
+
+func TestNormalizeHighlights(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		highlights []models.Highlight
+		want       []models.Highlight
+	}{
+		{"none", "hello world", nil, []models.Highlight{}},
+		{"text filled", "hello world", []models.Highlight{{Start: 6, End: 11, Text: "ignored"}},
+			[]models.Highlight{{Start: 6, End: 11, Text: "world"}}},
+		{"whole text", "hello", []models.Highlight{{Start: 0, End: 5}},
+			[]models.Highlight{{Start: 0, End: 5, Text: "hello"}}},
+		{"rune offsets", "café 日本語 ok", []models.Highlight{{Start: 5, End: 8}, {Start: 3, End: 4}},
+			[]models.Highlight{{Start: 3, End: 4, Text: "é"}, {Start: 5, End: 8, Text: "日本語"}}},
+		{"sorted by start then end", "abcdef", []models.Highlight{{Start: 2, End: 4}, {Start: 0, End: 3}, {Start: 0, End: 1}},
+			[]models.Highlight{{Start: 0, End: 1, Text: "a"}, {Start: 0, End: 3, Text: "abc"}, {Start: 2, End: 4, Text: "cd"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeHighlights(tt.text, tt.highlights)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeHighlights = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeHighlightsInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		highlight models.Highlight
+	}{
+		{"negative start", "hello", models.Highlight{Start: -1, End: 2}},
+		{"empty", "hello", models.Highlight{Start: 2, End: 2}},
+		{"reversed", "hello", models.Highlight{Start: 3, End: 1}},
+		{"past the end", "hello", models.Highlight{Start: 3, End: 6}},
+		{"byte offsets", "日本語", models.Highlight{Start: 0, End: 9}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NormalizeHighlights(tt.text, []models.Highlight{tt.highlight}); !errors.Is(err, ErrInvalidAnnotation) {
+				t.Errorf("NormalizeHighlights(%+v) err = %v, want ErrInvalidAnnotation", tt.highlight, err)
+			}
+		})
+	}
+}
+
+func TestAnnotateBookmark(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	saveBookmarks(t, s, testBookmark("1", "hello gophers"))
+
+	bookmark, err := s.GetBookmark(ctx, testUserID, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bookmark.AnnotatedAt != nil {
+		t.Errorf("annotated at = %v, want nil before any annotation", bookmark.AnnotatedAt)
+	}
+
+	annotatedAt := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	highlights := []models.Highlight{{Start: 6, End: 13, Text: "gophers"}}
+	if err := s.AnnotateBookmark(ctx, testUserID, "1", "read later", highlights, annotatedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	// syncing the bookmark again keeps its annotations
+	saveBookmarks(t, s, testBookmark("1", "hello gophers"))
+
+	bookmark, err = s.GetBookmark(ctx, testUserID, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bookmark.Note != "read later" || !reflect.DeepEqual(bookmark.Highlights, highlights) {
+		t.Errorf("annotations = %q, %+v, want %q, %+v", bookmark.Note, bookmark.Highlights, "read later", highlights)
+	}
+	if bookmark.AnnotatedAt == nil || !bookmark.AnnotatedAt.Equal(annotatedAt) {
+		t.Errorf("annotated at = %v, want %v", bookmark.AnnotatedAt, annotatedAt)
+	}
+
+	if err := s.AnnotateBookmark(ctx, testUserID, "2", "", nil, annotatedAt); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AnnotateBookmark() err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,357 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"twitter-bookmarks/models"
+)
+
+// KnownBookmarks returns which of tweetIDs are archived and still bookmarked for an account
+func (s *SQLiteStore) KnownBookmarks(ctx context.Context, userID string, tweetIDs []string) (map[string]bool, error) {
+	known := make(map[string]bool)
+	if len(tweetIDs) == 0 {
+		return known, nil
+	}
+
+	args := make([]any, 0, len(tweetIDs)+1)
+	args = append(args, userID)
+	for _, id := range tweetIDs {
+		args = append(args, id)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT tweet_id FROM bookmarks WHERE user_id = ? AND removed_at = 0 AND tweet_id IN (`+placeholders(len(tweetIDs))+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bookmarks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan bookmark: %w", err)
+		}
+		known[id] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query bookmarks: %w", err)
+	}
+
+	return known, nil
+}
+
+// SaveBookmarks inserts new bookmarks and updates known ones, seenAt is when they were fetched.
+// New and restored bookmarks are recorded as added in the history and the rules are applied to
+// them in the same transaction, it returns the bookmarks matched by each rule.
+func (s *SQLiteStore) SaveBookmarks(ctx context.Context, userID string, bookmarks []models.Bookmark, rules []models.Rule, seenAt time.Time) ([]models.RuleMatches, error) {
+	matchers, err := newRuleMatchers(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO bookmarks (user_id, tweet_id, created_at, author_id, author_username,
+		text, lang, like_count, retweet_count, has_media, has_links, data, first_seen_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, tweet_id) DO UPDATE SET created_at = excluded.created_at, author_id = excluded.author_id,
+		author_username = excluded.author_username, text = excluded.text, lang = excluded.lang,
+		like_count = excluded.like_count, retweet_count = excluded.retweet_count, has_media = excluded.has_media,
+		has_links = excluded.has_links, data = excluded.data, last_seen_at = excluded.last_seen_at, removed_at = 0`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	active, err := tx.PrepareContext(ctx, `SELECT removed_at = 0 FROM bookmarks WHERE user_id = ? AND tweet_id = ?`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer active.Close()
+
+	matches := emptyMatches(rules)
+	for _, bookmark := range bookmarks {
+		var bookmarked bool
+		err := active.QueryRowContext(ctx, userID, bookmark.TweetID).Scan(&bookmarked)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to get bookmark %s: %w", bookmark.TweetID, err)
+		}
+
+		if !bookmarked {
+			if err := insertEvent(ctx, tx, userID, bookmark.TweetID, models.BookmarkAdded, seenAt); err != nil {
+				return nil, err
+			}
+
+			for i, matcher := range matchers {
+				if matcher.matches(bookmark) {
+					matches[i].TweetIDs = append(matches[i].TweetIDs, bookmark.TweetID)
+				}
+			}
+		}
+
+		data, err := json.Marshal(bookmark)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode bookmark %s: %w", bookmark.TweetID, err)
+		}
+
+		_, err = stmt.ExecContext(ctx, userID, bookmark.TweetID, toUnix(bookmark.CreatedAt), bookmark.Author.ID,
+			bookmark.Author.Username, bookmark.Text, bookmark.Lang, bookmark.PublicMetrics.LikeCount,
+			bookmark.PublicMetrics.RetweetCount, len(bookmark.Attachments.MediaKeys) > 0, len(bookmark.Entities.URLs) > 0,
+			data, toUnix(seenAt), toUnix(seenAt))
+		if err != nil {
+			return nil, fmt.Errorf("failed to save bookmark %s: %w", bookmark.TweetID, err)
+		}
+	}
+
+	if err := applyRules(ctx, tx, userID, rules, matches, seenAt); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit bookmarks: %w", err)
+	}
+
+	return matches, nil
+}
+
+// RemoveBookmarks tombstones the bookmarks of an account missing from keep and records them as
+// removed in the history, it returns how many bookmarks were removed
+func (s *SQLiteStore) RemoveBookmarks(ctx context.Context, userID string, keep []string, removedAt time.Time) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT tweet_id FROM bookmarks WHERE user_id = ? AND removed_at = 0`
+	args := make([]any, 0, len(keep)+1)
+	args = append(args, userID)
+	if len(keep) > 0 {
+		query += ` AND tweet_id NOT IN (` + placeholders(len(keep)) + `)`
+		for _, id := range keep {
+			args = append(args, id)
+		}
+	}
+
+	removed, err := queryStrings(ctx, tx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query bookmarks: %w", err)
+	}
+
+	for _, tweetID := range removed {
+		_, err := tx.ExecContext(ctx, `UPDATE bookmarks SET removed_at = ? WHERE user_id = ? AND tweet_id = ?`,
+			toUnix(removedAt), userID, tweetID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to remove bookmark %s: %w", tweetID, err)
+		}
+
+		if err := insertEvent(ctx, tx, userID, tweetID, models.BookmarkRemoved, removedAt); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit bookmarks: %w", err)
+	}
+
+	return len(removed), nil
+}
+
+// GetBookmark returns an archived bookmark of an account
+func (s *SQLiteStore) GetBookmark(ctx context.Context, userID, tweetID string) (*models.Bookmark, error) {
+	bookmark, err := scanBookmark(s.db.QueryRowContext(ctx, `SELECT `+bookmarkColumns+` FROM bookmarks b WHERE b.user_id = ? AND b.tweet_id = ?`,
+		userID, tweetID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get bookmark: %w", err)
+	}
+
+	return bookmark, nil
+}
+
+// DeleteArchive removes the archived bookmarks of an account along with their history, tags,
+// collections, rules and threads
+func (s *SQLiteStore) DeleteArchive(ctx context.Context, userID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// the bookmarks of the deleted collections are removed by ON DELETE CASCADE
+	for _, table := range []string{"bookmarks", "bookmark_events", "bookmark_tags", "collections", "rules", "threads"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit archive: %w", err)
+	}
+
+	return nil
+}
+
+// HistoryFilter selects a page of the bookmark history of an account
+type HistoryFilter struct {
+	// From and To bound the events to those that occurred in [From, To), a zero time leaves the
+	// range open on that side
+	From, To time.Time
+
+	Limit  int
+	Offset int
+}
+
+// BookmarkHistory returns a page of the events of an account kept by filter, most recent first
+func (s *SQLiteStore) BookmarkHistory(ctx context.Context, userID string, filter HistoryFilter) (*models.HistoryResponse, error) {
+	query := `SELECT e.type, e.occurred_at, ` + bookmarkColumns + ` FROM bookmark_events e
+		JOIN bookmarks b ON b.user_id = e.user_id AND b.tweet_id = e.tweet_id
+		WHERE e.user_id = ?`
+	args := []any{userID}
+	if !filter.From.IsZero() {
+		query += ` AND e.occurred_at >= ?`
+		args = append(args, toUnix(filter.From))
+	}
+	if !filter.To.IsZero() {
+		query += ` AND e.occurred_at < ?`
+		args = append(args, toUnix(filter.To))
+	}
+	query += ` ORDER BY e.occurred_at DESC, e.id DESC LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit+1, filter.Offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]models.BookmarkEvent, 0)
+	for rows.Next() {
+		var (
+			event      models.BookmarkEvent
+			occurredAt int64
+		)
+
+		bookmark, err := scanBookmark(rows, &event.Type, &occurredAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+
+		event.TweetID = bookmark.TweetID
+		event.OccurredAt = fromUnix(occurredAt)
+		event.Bookmark = bookmark
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+
+	response := &models.HistoryResponse{Events: events}
+	if len(events) > filter.Limit {
+		response.Events = events[:filter.Limit]
+		response.NextCursor = strconv.Itoa(filter.Offset + filter.Limit)
+	}
+
+	return response, nil
+}
+
+func insertEvent(ctx context.Context, tx *sql.Tx, userID, tweetID string, eventType models.BookmarkEventType, occurredAt time.Time) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO bookmark_events (user_id, tweet_id, type, occurred_at) VALUES (?, ?, ?, ?)`,
+		userID, tweetID, eventType, toUnix(occurredAt))
+	if err != nil {
+		return fmt.Errorf("failed to record %s event for %s: %w", eventType, tweetID, err)
+	}
+
+	return nil
+}
+
+// queryStrings returns the first column of the rows returned by query
+func queryStrings(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]string, 0)
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+const bookmarkColumns = `b.data, b.first_seen_at, b.last_seen_at, b.removed_at, b.note, b.highlights, b.annotated_at,
+	(SELECT group_concat(t.tag, char(31)) FROM bookmark_tags t WHERE t.user_id = b.user_id AND t.tweet_id = b.tweet_id)`
+
+// scanBookmark scans a row selecting bookmarkColumns after the columns scanned into dest
+func scanBookmark(row scanner, dest ...any) (*models.Bookmark, error) {
+	var (
+		bookmark                           models.Bookmark
+		data                               []byte
+		firstSeenAt, lastSeenAt, removedAt int64
+		note                               string
+		highlights                         []byte
+		annotatedAt                        int64
+		tags                               sql.NullString
+	)
+
+	if err := row.Scan(append(dest, &data, &firstSeenAt, &lastSeenAt, &removedAt, &note, &highlights, &annotatedAt, &tags)...); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &bookmark); err != nil {
+		return nil, fmt.Errorf("failed to decode bookmark: %w", err)
+	}
+
+	bookmark.Note = note
+	bookmark.Highlights = nil
+	if err := json.Unmarshal(highlights, &bookmark.Highlights); err != nil {
+		return nil, fmt.Errorf("failed to decode highlights: %w", err)
+	}
+	bookmark.AnnotatedAt = nil
+	if annotatedAt != 0 {
+		annotated := fromUnix(annotatedAt)
+		bookmark.AnnotatedAt = &annotated
+	}
+
+	bookmark.FirstSeenAt = fromUnix(firstSeenAt)
+	bookmark.LastSeenAt = fromUnix(lastSeenAt)
+	bookmark.Bookmarked = removedAt == 0
+	bookmark.RemovedAt = nil
+	if removedAt != 0 {
+		removed := fromUnix(removedAt)
+		bookmark.RemovedAt = &removed
+	}
+	bookmark.Tags = nil
+	if tags.Valid {
+		bookmark.Tags = strings.Split(tags.String, "\x1f")
+		sort.Strings(bookmark.Tags)
+	}
+
+	return &bookmark, nil
+}
+
+// placeholders returns n comma separated query placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,422 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"twitter-bookmarks/models"
+)
+
+var (
+	// ErrCollectionNotFound is returned when a collection does not exist for an account
+	ErrCollectionNotFound = fmt.Errorf("collection %w", ErrNotFound)
+	// ErrCollectionExists is returned when an account already has a collection with the same name
+	ErrCollectionExists = errors.New("collection already exists")
+	// ErrInvalidCollection is returned when the name or description of a collection is invalid
+	ErrInvalidCollection = errors.New("invalid collection")
+)
+
+const (
+	// maxCollectionNameLength is the maximum number of characters of a collection name
+	maxCollectionNameLength = 100
+	// maxCollectionDescriptionLength is the maximum number of characters of a collection description
+	maxCollectionDescriptionLength = 1000
+)
+
+// CollectionUpdate holds the fields of a collection to update, nil fields are kept
+type CollectionUpdate struct {
+	Name        *string
+	Description *string
+	// Position moves the collection among the collections of the account, starting at 0
+	Position *int
+}
+
+const collectionColumns = `c.id, c.name, c.description, c.position, c.created_at, c.updated_at,
+	(SELECT count(*) FROM collection_bookmarks cb WHERE cb.collection_id = c.id)`
+
+func scanCollection(row scanner) (*models.Collection, error) {
+	var (
+		collection           models.Collection
+		createdAt, updatedAt int64
+	)
+
+	err := row.Scan(&collection.ID, &collection.Name, &collection.Description, &collection.Position,
+		&createdAt, &updatedAt, &collection.Count)
+	if err != nil {
+		return nil, err
+	}
+
+	collection.CreatedAt = fromUnix(createdAt)
+	collection.UpdatedAt = fromUnix(updatedAt)
+
+	return &collection, nil
+}
+
+// ListCollections returns the collections of an account in their order
+func (s *SQLiteStore) ListCollections(ctx context.Context, userID string) ([]models.Collection, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+collectionColumns+` FROM collections c WHERE c.user_id = ?
+		ORDER BY c.position, c.id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query collections: %w", err)
+	}
+	defer rows.Close()
+
+	collections := make([]models.Collection, 0)
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan collection: %w", err)
+		}
+		collections = append(collections, *collection)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query collections: %w", err)
+	}
+
+	return collections, nil
+}
+
+// GetCollection returns a collection of an account
+func (s *SQLiteStore) GetCollection(ctx context.Context, userID string, id int64) (*models.Collection, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+collectionColumns+` FROM collections c WHERE c.user_id = ? AND c.id = ?`, userID, id)
+
+	collection, err := scanCollection(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCollectionNotFound
+		}
+		return nil, fmt.Errorf("failed to get collection: %w", err)
+	}
+
+	return collection, nil
+}
+
+// CreateCollection creates an empty collection after the other collections of an account
+func (s *SQLiteStore) CreateCollection(ctx context.Context, userID, name, description string, now time.Time) (*models.Collection, error) {
+	name, err := validateCollection(name, description)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.ExecContext(ctx, `INSERT INTO collections (user_id, name, description, position, created_at, updated_at)
+		VALUES (?, ?, ?, (SELECT count(*) FROM collections WHERE user_id = ?), ?, ?)`,
+		userID, name, description, userID, toUnix(now), toUnix(now))
+	if err != nil {
+		if isUniqueError(err) {
+			return nil, fmt.Errorf("%w: %q", ErrCollectionExists, name)
+		}
+		return nil, fmt.Errorf("failed to create collection: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create collection: %w", err)
+	}
+
+	return s.GetCollection(ctx, userID, id)
+}
+
+// UpdateCollection renames, describes or moves a collection of an account
+func (s *SQLiteStore) UpdateCollection(ctx context.Context, userID string, id int64, update CollectionUpdate, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var name, description string
+	err = tx.QueryRowContext(ctx, `SELECT name, description FROM collections WHERE user_id = ? AND id = ?`, userID, id).
+		Scan(&name, &description)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCollectionNotFound
+		}
+		return fmt.Errorf("failed to get collection: %w", err)
+	}
+
+	if update.Name != nil {
+		name = *update.Name
+	}
+	if update.Description != nil {
+		description = *update.Description
+	}
+	if name, err = validateCollection(name, description); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE collections SET name = ?, description = ?, updated_at = ? WHERE id = ?`,
+		name, description, toUnix(now), id)
+	if err != nil {
+		if isUniqueError(err) {
+			return fmt.Errorf("%w: %q", ErrCollectionExists, name)
+		}
+		return fmt.Errorf("failed to update collection: %w", err)
+	}
+
+	if update.Position != nil {
+		ids, err := queryStrings(ctx, tx, `SELECT id FROM collections WHERE user_id = ? ORDER BY position, id`, userID)
+		if err != nil {
+			return fmt.Errorf("failed to query collections: %w", err)
+		}
+
+		ids = move(ids, fmt.Sprint(id), *update.Position)
+		if err := setPositions(ctx, tx, `UPDATE collections SET position = ? WHERE id = ?`, ids); err != nil {
+			return fmt.Errorf("failed to move collection: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit collection: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteCollection deletes a collection of an account, its bookmarks are kept in the archive
+func (s *SQLiteStore) DeleteCollection(ctx context.Context, userID string, id int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM collections WHERE user_id = ? AND id = ?`, userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+	if deleted == 0 {
+		return ErrCollectionNotFound
+	}
+
+	ids, err := queryStrings(ctx, tx, `SELECT id FROM collections WHERE user_id = ? ORDER BY position, id`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to query collections: %w", err)
+	}
+
+	if err := setPositions(ctx, tx, `UPDATE collections SET position = ? WHERE id = ?`, ids); err != nil {
+		return fmt.Errorf("failed to reorder collections: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit collection: %w", err)
+	}
+
+	return nil
+}
+
+// AddToCollection appends archived bookmarks to a collection of an account in the given order,
+// bookmarks already in the collection keep their position
+func (s *SQLiteStore) AddToCollection(ctx context.Context, userID string, id int64, tweetIDs []string, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := collectionExists(ctx, tx, userID, id); err != nil {
+		return err
+	}
+
+	for _, tweetID := range tweetIDs {
+		if err := bookmarkExists(ctx, tx, userID, tweetID); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO collection_bookmarks (collection_id, tweet_id, position, added_at)
+			VALUES (?, ?, (SELECT count(*) FROM collection_bookmarks WHERE collection_id = ?), ?)`,
+			id, tweetID, id, toUnix(now))
+		if err != nil {
+			return fmt.Errorf("failed to add %s to collection: %w", tweetID, err)
+		}
+	}
+
+	if err := touchCollection(ctx, tx, id, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit collection: %w", err)
+	}
+
+	return nil
+}
+
+// MoveInCollection moves a bookmark to position in a collection of an account, starting at 0
+func (s *SQLiteStore) MoveInCollection(ctx context.Context, userID string, id int64, tweetID string, position int, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	tweetIDs, err := collectionTweetIDs(ctx, tx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	if !contains(tweetIDs, tweetID) {
+		return ErrNotFound
+	}
+
+	tweetIDs = move(tweetIDs, tweetID, position)
+	err = setPositions(ctx, tx, `UPDATE collection_bookmarks SET position = ? WHERE tweet_id = ? AND collection_id = ?`, tweetIDs, id)
+	if err != nil {
+		return fmt.Errorf("failed to move bookmark: %w", err)
+	}
+
+	if err := touchCollection(ctx, tx, id, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit collection: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveFromCollection removes a bookmark from a collection of an account
+func (s *SQLiteStore) RemoveFromCollection(ctx context.Context, userID string, id int64, tweetID string, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	tweetIDs, err := collectionTweetIDs(ctx, tx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	if !contains(tweetIDs, tweetID) {
+		return ErrNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM collection_bookmarks WHERE collection_id = ? AND tweet_id = ?`, id, tweetID)
+	if err != nil {
+		return fmt.Errorf("failed to remove bookmark from collection: %w", err)
+	}
+
+	tweetIDs = move(tweetIDs, tweetID, len(tweetIDs))
+	err = setPositions(ctx, tx, `UPDATE collection_bookmarks SET position = ? WHERE tweet_id = ? AND collection_id = ?`,
+		tweetIDs[:len(tweetIDs)-1], id)
+	if err != nil {
+		return fmt.Errorf("failed to reorder collection: %w", err)
+	}
+
+	if err := touchCollection(ctx, tx, id, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit collection: %w", err)
+	}
+
+	return nil
+}
+
+// validateCollection checks the name and description of a collection, returning the trimmed name
+func validateCollection(name, description string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxCollectionNameLength {
+		return "", fmt.Errorf("%w: names must hold 1 to %d characters", ErrInvalidCollection, maxCollectionNameLength)
+	}
+
+	if utf8.RuneCountInString(description) > maxCollectionDescriptionLength {
+		return "", fmt.Errorf("%w: descriptions are limited to %d characters", ErrInvalidCollection, maxCollectionDescriptionLength)
+	}
+
+	return name, nil
+}
+
+// collectionExists returns ErrCollectionNotFound unless a collection exists for an account
+func collectionExists(ctx context.Context, tx *sql.Tx, userID string, id int64) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM collections WHERE user_id = ? AND id = ?)`,
+		userID, id).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to get collection: %w", err)
+	}
+
+	if !exists {
+		return ErrCollectionNotFound
+	}
+
+	return nil
+}
+
+// collectionTweetIDs returns the IDs of the bookmarks of a collection in their order
+func collectionTweetIDs(ctx context.Context, tx *sql.Tx, userID string, id int64) ([]string, error) {
+	if err := collectionExists(ctx, tx, userID, id); err != nil {
+		return nil, err
+	}
+
+	tweetIDs, err := queryStrings(ctx, tx, `SELECT tweet_id FROM collection_bookmarks WHERE collection_id = ?
+		ORDER BY position, added_at`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query collection: %w", err)
+	}
+
+	return tweetIDs, nil
+}
+
+func touchCollection(ctx context.Context, tx *sql.Tx, id int64, now time.Time) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE collections SET updated_at = ? WHERE id = ?`, toUnix(now), id); err != nil {
+		return fmt.Errorf("failed to update collection: %w", err)
+	}
+
+	return nil
+}
+
+// setPositions runs query with the index and key of each key in order, followed by args
+func setPositions(ctx context.Context, tx *sql.Tx, query string, keys []string, args ...any) error {
+	for i, key := range keys {
+		if _, err := tx.ExecContext(ctx, query, append([]any{i, key}, args...)...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// move returns keys with key moved to position, which is clamped to the bounds of keys
+func move(keys []string, key string, position int) []string {
+	moved := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k != key {
+			moved = append(moved, k)
+		}
+	}
+
+	if position < 0 {
+		position = 0
+	}
+	if position > len(moved) {
+		position = len(moved)
+	}
+
+	moved = append(moved[:position], append([]string{key}, moved[position:]...)...)
+
+	return moved
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		position int
+		want     []string
+	}{
+		{"to front", "c", 0, []string{"c", "a", "b", "d"}},
+		{"to end", "a", 3, []string{"b", "c", "d", "a"}},
+		{"forward", "a", 2, []string{"b", "c", "a", "d"}},
+		{"backward", "d", 1, []string{"a", "d", "b", "c"}},
+		{"same position", "b", 1, []string{"a", "b", "c", "d"}},
+		{"clamped below", "c", -5, []string{"c", "a", "b", "d"}},
+		{"clamped above", "b", 10, []string{"a", "c", "d", "b"}},
+		{"new key", "e", 1, []string{"a", "e", "b", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := []string{"a", "b", "c", "d"}
+			if got := move(keys, tt.key, tt.position); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("move(%q, %d) = %q, want %q", tt.key, tt.position, got, tt.want)
+			}
+			if !reflect.DeepEqual(keys, []string{"a", "b", "c", "d"}) {
+				t.Errorf("move modified its keys: %q", keys)
+			}
+		})
+	}
+}
+
+// collectionOrder returns the bookmarks of a collection in their order
+func collectionOrder(t *testing.T, s *SQLiteStore, id int64) []string {
+	t.Helper()
+
+	tx, err := s.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	tweetIDs, err := collectionTweetIDs(context.Background(), tx, testUserID, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tweetIDs
+}
+
+// collectionNames returns the names of the collections of the test account in their order
+func collectionNames(t *testing.T, s *SQLiteStore) []string {
+	t.Helper()
+
+	collections, err := s.ListCollections(context.Background(), testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(collections))
+	for i, collection := range collections {
+		if collection.Position != i {
+			t.Errorf("collection %q at position %d, want %d", collection.Name, collection.Position, i)
+		}
+		names = append(names, collection.Name)
+	}
+
+	return names
+}
+
+func TestCollectionBookmarksOrder(t *testing.T) {
+	ctx, now := context.Background(), time.Now()
+	s := newTestStore(t)
+	saveBookmarks(t, s, testBookmark("1", "one"), testBookmark("2", "two"), testBookmark("3", "three"), testBookmark("4", "four"))
+
+	collection, err := s.CreateCollection(ctx, testUserID, "reading", "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := collection.ID
+
+	steps := []struct {
+		name string
+		run  func() error
+		want []string
+	}{
+		{"add in order", func() error { return s.AddToCollection(ctx, testUserID, id, []string{"3", "1"}, now) }, []string{"3", "1"}},
+		{"add keeps positions", func() error { return s.AddToCollection(ctx, testUserID, id, []string{"1", "4", "2"}, now) }, []string{"3", "1", "4", "2"}},
+		{"move forward", func() error { return s.MoveInCollection(ctx, testUserID, id, "3", 2, now) }, []string{"1", "4", "3", "2"}},
+		{"move to front", func() error { return s.MoveInCollection(ctx, testUserID, id, "2", 0, now) }, []string{"2", "1", "4", "3"}},
+		{"move past the end", func() error { return s.MoveInCollection(ctx, testUserID, id, "1", 99, now) }, []string{"2", "4", "3", "1"}},
+		{"remove", func() error { return s.RemoveFromCollection(ctx, testUserID, id, "4", now) }, []string{"2", "3", "1"}},
+		{"add after remove", func() error { return s.AddToCollection(ctx, testUserID, id, []string{"4"}, now) }, []string{"2", "3", "1", "4"}},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := collectionOrder(t, s, id); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: order = %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	if err := s.MoveInCollection(ctx, testUserID, id, "5", 0, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("moving a bookmark out of the collection: err = %v, want ErrNotFound", err)
+	}
+	if err := s.AddToCollection(ctx, testUserID, id, []string{"5"}, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("adding an unknown bookmark: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCollectionsOrder(t *testing.T) {
+	ctx, now := context.Background(), time.Now()
+	s := newTestStore(t)
+
+	ids := make(map[string]int64)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		collection, err := s.CreateCollection(ctx, testUserID, name, "", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = collection.ID
+	}
+	if got, want := collectionNames(t, s), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("created collections = %q, want %q", got, want)
+	}
+
+	position := func(p int) *int { return &p }
+	steps := []struct {
+		name     string
+		position *int
+		want     []string
+	}{
+		{"a", position(2), []string{"b", "c", "a", "d"}},
+		{"d", position(0), []string{"d", "b", "c", "a"}},
+		{"b", position(-1), []string{"b", "d", "c", "a"}},
+		{"c", position(10), []string{"b", "d", "a", "c"}},
+		{"d", nil, []string{"b", "d", "a", "c"}},
+	}
+
+	for _, step := range steps {
+		if err := s.UpdateCollection(ctx, testUserID, ids[step.name], CollectionUpdate{Position: step.position}, now); err != nil {
+			t.Fatal(err)
+		}
+		if got := collectionNames(t, s); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("after moving %s: order = %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	if err := s.DeleteCollection(ctx, testUserID, ids["d"]); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := collectionNames(t, s), []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after deleting d: order = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"twitter-bookmarks/models"
+)
+
+type fileAccount struct {
+	User  models.User   `json:"user"`
+	Token *models.Token `json:"token,omitempty"`
+}
+
+// FileStore stores the accounts as JSON in a file only readable by its owner
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileStore creates an account store backed by the file at path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// GetUser returns the account with the given Twitter user ID
+func (f *FileStore) GetUser(ctx context.Context, id string) (*models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	accounts, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	account, ok := accounts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &account.User, nil
+}
+
+// ListUsers returns every account ordered by user ID
+func (f *FileStore) ListUsers(ctx context.Context) ([]models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	accounts, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]models.User, 0, len(accounts))
+	for _, account := range accounts {
+		users = append(users, account.User)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+// SaveUser creates or updates an account, keeping its token
+func (f *FileStore) SaveUser(ctx context.Context, user *models.User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	accounts, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	account := accounts[user.ID]
+	account.User = *user
+	accounts[user.ID] = account
+
+	return f.write(accounts)
+}
+
+// DeleteUser removes an account and its token
+func (f *FileStore) DeleteUser(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	accounts, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	delete(accounts, id)
+
+	return f.write(accounts)
+}
+
+// LoadToken returns the token of an account
+func (f *FileStore) LoadToken(ctx context.Context, userID string) (*models.Token, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	accounts, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	account, ok := accounts[userID]
+	if !ok || account.Token == nil {
+		return nil, ErrNotFound
+	}
+
+	return account.Token, nil
+}
+
+// SaveToken replaces the token of an account, the account must exist
+func (f *FileStore) SaveToken(ctx context.Context, userID string, token *models.Token) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	accounts, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	account, ok := accounts[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	account.Token = token
+	accounts[userID] = account
+
+	return f.write(accounts)
+}
+
+// DeleteToken removes the token of an account, keeping the account
+func (f *FileStore) DeleteToken(ctx context.Context, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	accounts, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	account, ok := accounts[userID]
+	if !ok {
+		return nil
+	}
+	account.Token = nil
+	accounts[userID] = account
+
+	return f.write(accounts)
+}
+
+func (f *FileStore) read() (map[string]fileAccount, error) {
+	accounts := make(map[string]fileAccount)
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return accounts, nil
+		}
+		return nil, fmt.Errorf("failed to read accounts file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to decode accounts file: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// write replaces the file content, the write is atomic so a crash never leaves a partial file behind
+func (f *FileStore) write(accounts map[string]fileAccount) error {
+	data, err := json.Marshal(accounts)
+	if err != nil {
+		return fmt.Errorf("failed to encode accounts: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create accounts file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write accounts file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write accounts file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to replace accounts file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+)
+
+// sameToken reports whether two tokens hold the same values
+func sameToken(got, want *models.Token) bool {
+	return got.AccessToken == want.AccessToken && got.RefreshToken == want.RefreshToken &&
+		got.Expiry.Equal(want.Expiry) && reflect.DeepEqual(got.Scopes, want.Scopes)
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "accounts.json")
+
+	f := NewFileStore(path)
+	if users, err := f.ListUsers(ctx); err != nil || len(users) != 0 {
+		t.Fatalf("ListUsers() = %v, %v, want no account before the file exists", users, err)
+	}
+
+	reader := models.User{ID: "2", Username: "reader", Name: "Reader"}
+	writer := models.User{ID: "1", Username: "writer", Name: "Writer"}
+	for _, user := range []models.User{reader, writer} {
+		user := user
+		if err := f.SaveUser(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token := &models.Token{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		Expiry:       time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC),
+		Scopes:       []string{"tweet.read", "bookmark.read"},
+	}
+	if err := f.SaveToken(ctx, reader.ID, token); err != nil {
+		t.Fatal(err)
+	}
+
+	// saving the account again keeps its token
+	reader.Name = "Avid Reader"
+	if err := f.SaveUser(ctx, &reader); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("accounts file mode = %o, want 600", perm)
+	}
+
+	// a new store reads what the first one wrote
+	f = NewFileStore(path)
+
+	users, err := f.ListUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []models.User{writer, reader}; !reflect.DeepEqual(users, want) {
+		t.Errorf("users = %+v, want %+v", users, want)
+	}
+
+	if user, err := f.GetUser(ctx, reader.ID); err != nil || user.Name != "Avid Reader" {
+		t.Errorf("GetUser() = %+v, %v, want the updated account", user, err)
+	}
+
+	got, err := f.LoadToken(ctx, reader.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameToken(got, token) {
+		t.Errorf("token = %+v, want %+v", got, token)
+	}
+
+	if _, err := f.LoadToken(ctx, writer.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LoadToken() of an account without token err = %v, want ErrNotFound", err)
+	}
+
+	if err := f.DeleteToken(ctx, reader.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path).LoadToken(ctx, reader.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LoadToken() after DeleteToken() err = %v, want ErrNotFound", err)
+	}
+	if _, err := f.GetUser(ctx, reader.ID); err != nil {
+		t.Errorf("GetUser() after DeleteToken() err = %v, want the account kept", err)
+	}
+
+	if err := f.DeleteToken(ctx, "3"); err != nil {
+		t.Errorf("DeleteToken() of an unknown account err = %v, want nil", err)
+	}
+
+	if err := f.DeleteUser(ctx, writer.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.GetUser(ctx, writer.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetUser() after DeleteUser() err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFileStoreSaveTokenUnknownAccount(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	f := NewFileStore(path)
+
+	if err := f.SaveToken(ctx, "1", &models.Token{AccessToken: "access"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SaveToken() err = %v, want ErrNotFound", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("accounts file stat err = %v, want no file written", err)
+	}
+
+	user := models.User{ID: "2", Username: "reader"}
+	if err := f.SaveUser(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SaveToken(ctx, "1", &models.Token{AccessToken: "access"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SaveToken() err = %v, want ErrNotFound", err)
+	}
+	if _, err := f.GetUser(ctx, "1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetUser() err = %v, want the unknown account not created", err)
+	}
+}
+
+func TestFileStoreCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileStore(path).ListUsers(context.Background()); err == nil {
+		t.Error("ListUsers() err = nil, want a decoding error")
+	}
+}
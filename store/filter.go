@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"twitter-bookmarks/models"
+)
+
+// BookmarkState selects archived bookmarks by whether they are still bookmarked on Twitter
+type BookmarkState string
+
+const (
+	AllBookmarks    BookmarkState = "all"
+	StateBookmarked BookmarkState = "bookmarked"
+	StateRemoved    BookmarkState = "removed"
+)
+
+// BookmarkSort is the order of archived bookmarks
+type BookmarkSort string
+
+const (
+	SortCreatedAt    BookmarkSort = "created_at"
+	SortBookmarkedAt BookmarkSort = "bookmarked_at"
+	SortLikes        BookmarkSort = "likes"
+	// SortPosition orders the bookmarks of a collection as arranged in it
+	SortPosition BookmarkSort = "position"
+)
+
+// BookmarkFilter selects and orders the archived bookmarks of an account
+type BookmarkFilter struct {
+	// After and Before keep the bookmarks tweeted in this range, zero times leave it open
+	After, Before time.Time
+	// Authors keeps the bookmarks written by one of these usernames
+	Authors     []string
+	HasMedia    bool
+	HasLinks    bool
+	Lang        string
+	MinLikes    int
+	MinRetweets int
+	// Tags keeps the bookmarks labeled with all these tags, or with any of them when AnyTag is set
+	Tags   []string
+	AnyTag bool
+	// Collection keeps the bookmarks of this collection, zero keeps every bookmark
+	Collection int64
+	// State keeps the bookmarks in this state, empty keeps all of them
+	State BookmarkState
+	// Sort orders the bookmarks, descending unless Ascending is set. Bookmarks are ordered by
+	// when they were first archived when empty, or by relevance for searches.
+	Sort      BookmarkSort
+	Ascending bool
+	Limit     int
+	Offset    int
+}
+
+// ListBookmarks returns the archived bookmarks of an account kept by filter
+func (s *SQLiteStore) ListBookmarks(ctx context.Context, userID string, filter BookmarkFilter) (*models.BookmarkResponse, error) {
+	where, args := filter.conditions(userID)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+bookmarkColumns+` FROM bookmarks b WHERE `+where+`
+		ORDER BY `+filter.orderBy()+` LIMIT ? OFFSET ?`, append(args, filter.Limit+1, filter.Offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bookmarks: %w", err)
+	}
+	defer rows.Close()
+
+	bookmarks := make([]models.Bookmark, 0)
+	for rows.Next() {
+		bookmark, err := scanBookmark(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan bookmark: %w", err)
+		}
+		bookmarks = append(bookmarks, *bookmark)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query bookmarks: %w", err)
+	}
+
+	response := &models.BookmarkResponse{Bookmarks: bookmarks}
+	if len(bookmarks) > filter.Limit {
+		response.Bookmarks = bookmarks[:filter.Limit]
+		response.NextCursor = strconv.Itoa(filter.Offset + filter.Limit)
+	}
+
+	return response, nil
+}
+
+// Validate checks the state and sort order of a filter
+func (f BookmarkFilter) Validate() error {
+	switch f.State {
+	case "", AllBookmarks, StateBookmarked, StateRemoved:
+	default:
+		return fmt.Errorf("state must be one of %s, %s or %s", AllBookmarks, StateBookmarked, StateRemoved)
+	}
+
+	switch f.Sort {
+	case "", SortCreatedAt, SortBookmarkedAt, SortLikes, SortPosition:
+	default:
+		return fmt.Errorf("sort must be one of %s, %s, %s or %s", SortCreatedAt, SortBookmarkedAt, SortLikes, SortPosition)
+	}
+
+	return nil
+}
+
+// conditions returns the conditions on the bookmarks table b selecting the bookmarks of an
+// account kept by the filter
+func (f BookmarkFilter) conditions(userID string) (string, []any) {
+	conditions := []string{`b.user_id = ?`}
+	args := []any{userID}
+
+	if len(f.Authors) > 0 {
+		conditions = append(conditions, `b.author_username COLLATE NOCASE IN (`+placeholders(len(f.Authors))+`)`)
+		for _, username := range f.Authors {
+			args = append(args, username)
+		}
+	}
+	if !f.After.IsZero() {
+		conditions = append(conditions, `b.created_at > ?`)
+		args = append(args, toUnix(f.After))
+	}
+	if !f.Before.IsZero() {
+		conditions = append(conditions, `b.created_at < ?`)
+		args = append(args, toUnix(f.Before))
+	}
+	if f.HasMedia {
+		conditions = append(conditions, `b.has_media`)
+	}
+	if f.HasLinks {
+		conditions = append(conditions, `b.has_links`)
+	}
+	if f.Lang != "" {
+		conditions = append(conditions, `b.lang = ?`)
+		args = append(args, f.Lang)
+	}
+	if f.MinLikes > 0 {
+		conditions = append(conditions, `b.like_count >= ?`)
+		args = append(args, f.MinLikes)
+	}
+	if f.MinRetweets > 0 {
+		conditions = append(conditions, `b.retweet_count >= ?`)
+		args = append(args, f.MinRetweets)
+	}
+	if len(f.Tags) > 0 {
+		tags := `SELECT count(DISTINCT t.tag) FROM bookmark_tags t WHERE t.user_id = b.user_id AND t.tweet_id = b.tweet_id
+			AND t.tag IN (` + placeholders(len(f.Tags)) + `)`
+		if f.AnyTag {
+			conditions = append(conditions, `(`+tags+`) > 0`)
+		} else {
+			conditions = append(conditions, `(`+tags+`) = ?`)
+		}
+		for _, tag := range f.Tags {
+			args = append(args, strings.ToLower(tag))
+		}
+		if !f.AnyTag {
+			args = append(args, len(f.Tags))
+		}
+	}
+	if f.Collection != 0 {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM collection_bookmarks cb WHERE cb.collection_id = ? AND cb.tweet_id = b.tweet_id)`)
+		args = append(args, f.Collection)
+	}
+	switch f.State {
+	case StateBookmarked:
+		conditions = append(conditions, `b.removed_at = 0`)
+	case StateRemoved:
+		conditions = append(conditions, `b.removed_at != 0`)
+	}
+
+	return strings.Join(conditions, ` AND `), args
+}
+
+// orderBy returns the ORDER BY clause of the filter. Bookmarks archived by the same sync share
+// their first seen time and were inserted from the most recently bookmarked, so the row order
+// breaks the tie.
+func (f BookmarkFilter) orderBy() string {
+	desc, asc := `DESC`, `ASC`
+	if f.Ascending {
+		desc, asc = asc, desc
+	}
+
+	switch {
+	case f.Sort == SortCreatedAt:
+		return `b.created_at ` + desc + `, b.tweet_id ` + desc
+	case f.Sort == SortLikes:
+		return `b.like_count ` + desc + `, b.created_at DESC, b.tweet_id DESC`
+	case f.Sort == SortPosition && f.Collection != 0:
+		return `(SELECT cb.position FROM collection_bookmarks cb WHERE cb.collection_id = ` + strconv.FormatInt(f.Collection, 10) +
+			` AND cb.tweet_id = b.tweet_id) ` + desc
+	default:
+		return `b.first_seen_at ` + desc + `, b.rowid ` + asc
+	}
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+)
+
+// listIDs returns the tweet IDs of the bookmarks of the test account kept by filter, reading
+// every page of filter.Limit bookmarks
+func listIDs(t *testing.T, s *SQLiteStore, filter BookmarkFilter) []string {
+	t.Helper()
+
+	ids := make([]string, 0)
+	for {
+		response, err := s.ListBookmarks(context.Background(), testUserID, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, bookmark := range response.Bookmarks {
+			ids = append(ids, bookmark.TweetID)
+		}
+
+		if response.NextCursor == "" {
+			return ids
+		}
+		offset, err := strconv.Atoi(response.NextCursor)
+		if err != nil || offset != filter.Offset+filter.Limit {
+			t.Fatalf("cursor = %q, want %d", response.NextCursor, filter.Offset+filter.Limit)
+		}
+		filter.Offset = offset
+	}
+}
+
+// filterBookmarks returns bookmarks tweeted a day apart from 1 to 6, most recently bookmarked first
+func filterBookmarks() []models.Bookmark {
+	bookmarks := make([]models.Bookmark, 0, 6)
+	for i, b := range []struct {
+		author          string
+		lang            string
+		likes, retweets int
+		media, link     bool
+	}{
+		{"Gopher", "en", 10, 1, true, false},
+		{"rustacean", "en", 50, 5, false, true},
+		{"gopher", "fr", 50, 0, true, true},
+		{"ziggy", "en", 0, 20, false, false},
+		{"GOPHER", "en", 5, 2, false, true},
+		{"rustacean", "de", 100, 0, true, false},
+	} {
+		bookmark := testBookmark(strconv.Itoa(i+1), "bookmark")
+		bookmark.CreatedAt = bookmark.CreatedAt.AddDate(0, 0, i)
+		bookmark.Author = models.Author{ID: b.author, Username: b.author}
+		bookmark.Lang = b.lang
+		bookmark.PublicMetrics = models.TweetMetrics{LikeCount: b.likes, RetweetCount: b.retweets}
+		if b.media {
+			bookmark.Attachments.MediaKeys = []string{"3_" + bookmark.TweetID}
+		}
+		if b.link {
+			bookmark.Entities.URLs = []models.URLEntity{{URL: "https://t.co/" + bookmark.TweetID}}
+		}
+		bookmarks = append(bookmarks, bookmark)
+	}
+
+	return bookmarks
+}
+
+func TestListBookmarksFilter(t *testing.T) {
+	s := newTestStore(t)
+	saveBookmarks(t, s, filterBookmarks()...)
+
+	day := func(n int) time.Time { return time.Date(2023, 1, n, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name   string
+		filter BookmarkFilter
+		want   []string
+	}{
+		{"everything", BookmarkFilter{}, []string{"1", "2", "3", "4", "5", "6"}},
+		{"author case insensitive", BookmarkFilter{Authors: []string{"gopher"}}, []string{"1", "3", "5"}},
+		{"authors", BookmarkFilter{Authors: []string{"ZIGGY", "Rustacean"}}, []string{"2", "4", "6"}},
+		{"has media", BookmarkFilter{HasMedia: true}, []string{"1", "3", "6"}},
+		{"has links", BookmarkFilter{HasLinks: true}, []string{"2", "3", "5"}},
+		{"has media and links", BookmarkFilter{HasMedia: true, HasLinks: true}, []string{"3"}},
+		{"lang", BookmarkFilter{Lang: "en"}, []string{"1", "2", "4", "5"}},
+		{"min likes", BookmarkFilter{MinLikes: 50}, []string{"2", "3", "6"}},
+		{"min retweets", BookmarkFilter{MinRetweets: 2}, []string{"2", "4", "5"}},
+		{"min likes and retweets", BookmarkFilter{MinLikes: 10, MinRetweets: 1}, []string{"1", "2"}},
+		{"tweeted in range", BookmarkFilter{After: day(2), Before: day(5)}, []string{"3", "4"}},
+		{"likes", BookmarkFilter{Sort: SortLikes}, []string{"6", "3", "2", "1", "5", "4"}},
+		{"likes ascending", BookmarkFilter{Sort: SortLikes, Ascending: true}, []string{"4", "5", "1", "3", "2", "6"}},
+		{"created at", BookmarkFilter{Sort: SortCreatedAt}, []string{"6", "5", "4", "3", "2", "1"}},
+		{"created at ascending", BookmarkFilter{Sort: SortCreatedAt, Ascending: true}, []string{"1", "2", "3", "4", "5", "6"}},
+		{"bookmarked at ascending", BookmarkFilter{Sort: SortBookmarkedAt, Ascending: true}, []string{"6", "5", "4", "3", "2", "1"}},
+		{"no match", BookmarkFilter{Lang: "en", MinLikes: 100}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Limit = 10
+			if got := listIDs(t, s, tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bookmarks = %v, want %v", got, tt.want)
+			}
+
+			// the pages of the filter follow each other
+			tt.filter.Limit = 1
+			if got := listIDs(t, s, tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paged bookmarks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListBookmarksPagesFiltered(t *testing.T) {
+	s := newTestStore(t)
+
+	// 250 bookmarks alternating between two authors, with likes repeating every 10 bookmarks
+	bookmarks := make([]models.Bookmark, 0, 250)
+	var want []string
+	for i := 1; i <= 250; i++ {
+		bookmark := testBookmark(strconv.Itoa(i), "bookmark")
+		bookmark.CreatedAt = bookmark.CreatedAt.Add(-time.Duration(i) * time.Minute)
+		bookmark.Author.Username = []string{"gopher", "rustacean"}[i%2]
+		bookmark.PublicMetrics.LikeCount = i % 10
+		bookmarks = append(bookmarks, bookmark)
+		if i%2 == 0 {
+			want = append(want, bookmark.TweetID)
+		}
+	}
+	saveBookmarks(t, s, bookmarks...)
+
+	if got := listIDs(t, s, BookmarkFilter{Authors: []string{"gopher"}, Limit: 20}); !reflect.DeepEqual(got, want) {
+		t.Errorf("bookmarks = %v, want %v", got, want)
+	}
+
+	// bookmarks with as many likes are neither repeated nor skipped across pages
+	byLikes := listIDs(t, s, BookmarkFilter{Authors: []string{"gopher"}, Sort: SortLikes, Limit: 7})
+	seen := make(map[string]bool)
+	for _, id := range byLikes {
+		seen[id] = true
+	}
+	if len(byLikes) != 125 || len(seen) != 125 {
+		t.Errorf("got %d bookmarks, %d distinct, want 125", len(byLikes), len(seen))
+	}
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+)
+
+// testUserID is the account owning the bookmarks of the tests
+const testUserID = "1"
+
+// newTestStore creates a store in an empty database
+func newTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "bookmarks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	s, err := NewSQLiteStore(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// testBookmark returns a bookmark of tweetID tweeted at the start of 2023
+func testBookmark(tweetID, text string) models.Bookmark {
+	return models.Bookmark{
+		ID:        tweetID,
+		TweetID:   tweetID,
+		Text:      text,
+		CreatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		Author:    models.Author{ID: "100", Username: "gopher", Name: "Gopher"},
+	}
+}
+
+// saveBookmarks archives bookmarks for the test account, the first one most recently bookmarked
+func saveBookmarks(t *testing.T, s *SQLiteStore, bookmarks ...models.Bookmark) {
+	t.Helper()
+
+	if _, err := s.SaveBookmarks(context.Background(), testUserID, bookmarks, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// resultIDs returns the tweet IDs of search results
+func resultIDs(results []models.SearchResult) []string {
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.Bookmark.TweetID)
+	}
+
+	return ids
+}
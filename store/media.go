@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"twitter-bookmarks/models"
+)
+
+// maxQueryURLs bounds the number of URLs looked up by a single query
+const maxQueryURLs = 500
+
+const mediaFileColumns = `url, hash, mime_type, size, attempts, error, mirrored_at`
+
+func scanMediaFile(row scanner) (*models.MediaFile, error) {
+	var (
+		file       models.MediaFile
+		mirroredAt int64
+	)
+
+	if err := row.Scan(&file.URL, &file.Hash, &file.MIMEType, &file.Size, &file.Attempts, &file.Error, &mirroredAt); err != nil {
+		return nil, err
+	}
+	file.MirroredAt = fromUnix(mirroredAt)
+
+	return &file, nil
+}
+
+// ArchivedMedia returns the media attached to the archived bookmarks of every account and to the
+// tweets they reference, media shared by several bookmarks are returned once
+func (s *SQLiteStore) ArchivedMedia(ctx context.Context) ([]models.Media, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT m.value FROM bookmarks b, json_each(b.data, '$.media') m
+		UNION SELECT m.value FROM bookmarks b, json_each(b.data, '$.quoted_tweet.media') m
+		UNION SELECT m.value FROM bookmarks b, json_each(b.data, '$.in_reply_to.media') m
+		UNION SELECT m.value FROM bookmarks b, json_each(b.data, '$.retweet_of.media') m`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query media: %w", err)
+	}
+	defer rows.Close()
+
+	media := make([]models.Media, 0)
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan media: %w", err)
+		}
+
+		var m models.Media
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("failed to decode media: %w", err)
+		}
+		media = append(media, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query media: %w", err)
+	}
+
+	return media, nil
+}
+
+// MediaFiles returns the mirrored files of urls keyed by URL, urls never mirrored are missing
+func (s *SQLiteStore) MediaFiles(ctx context.Context, urls []string) (map[string]models.MediaFile, error) {
+	files := make(map[string]models.MediaFile, len(urls))
+	for start := 0; start < len(urls); start += maxQueryURLs {
+		end := start + maxQueryURLs
+		if end > len(urls) {
+			end = len(urls)
+		}
+
+		args := make([]any, 0, end-start)
+		for _, url := range urls[start:end] {
+			args = append(args, url)
+		}
+
+		if err := s.queryMediaFiles(ctx, files, `SELECT `+mediaFileColumns+` FROM media_files
+			WHERE url IN (`+placeholders(len(args))+`)`, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+func (s *SQLiteStore) queryMediaFiles(ctx context.Context, files map[string]models.MediaFile, query string, args ...any) error {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query media files: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		file, err := scanMediaFile(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan media file: %w", err)
+		}
+		files[file.URL] = *file
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query media files: %w", err)
+	}
+
+	return nil
+}
+
+// SaveMediaFile creates or replaces the mirrored file of a URL
+func (s *SQLiteStore) SaveMediaFile(ctx context.Context, file models.MediaFile) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO media_files (`+mediaFileColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET hash = excluded.hash, mime_type = excluded.mime_type, size = excluded.size,
+		attempts = excluded.attempts, error = excluded.error, mirrored_at = excluded.mirrored_at`,
+		file.URL, file.Hash, file.MIMEType, file.Size, file.Attempts, file.Error, toUnix(file.MirroredAt))
+	if err != nil {
+		return fmt.Errorf("failed to save media file: %w", err)
+	}
+
+	return nil
+}
+
+// MediaFileByHash returns a mirrored file holding the content with the given hash
+func (s *SQLiteStore) MediaFileByHash(ctx context.Context, hash string) (*models.MediaFile, error) {
+	file, err := scanMediaFile(s.db.QueryRowContext(ctx, `SELECT `+mediaFileColumns+` FROM media_files
+		WHERE hash = ? LIMIT 1`, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get media file: %w", err)
+	}
+
+	return file, nil
+}
@@ -0,0 +1,405 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrInvalidQuery is returned when a search query cannot be parsed
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// SearchQuery is a parsed search over the archived bookmarks of an account
+type SearchQuery struct {
+	// Match is the FTS expression bookmarks must match, empty matches every bookmark. Match and
+	// Exclude are only built by ParseSearchQuery, which always produces valid expressions.
+	Match string
+	// Exclude is the FTS expression bookmarks must not match, empty excludes nothing
+	Exclude string
+	BookmarkFilter
+}
+
+// ParseSearchQuery parses a query made of words, "quoted phrases", prefix* terms combined with
+// AND, OR, NOT (or a leading -) and parentheses, plus from:username, tag:name, before:date and
+// after:date operators narrowing filter. Words next to each other must all match.
+func ParseSearchQuery(q string, filter BookmarkFilter) (SearchQuery, error) {
+	query := SearchQuery{BookmarkFilter: filter}
+
+	tokens, err := lexQuery(q)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+
+	// the operators filter the whole query wherever they appear
+	terms := tokens[:0]
+	for _, token := range tokens {
+		if token.kind != tokenWord {
+			terms = append(terms, token)
+			continue
+		}
+
+		name, value, ok := strings.Cut(token.text, ":")
+		if !ok || value == "" {
+			terms = append(terms, token)
+			continue
+		}
+
+		switch strings.ToLower(name) {
+		case "from":
+			query.Authors = append(query.Authors, strings.TrimPrefix(value, "@"))
+		case "tag":
+			query.Tags = append(query.Tags, value)
+		case "before":
+			if query.Before, err = parseQueryDate(value); err != nil {
+				return SearchQuery{}, err
+			}
+		case "after":
+			if query.After, err = parseQueryDate(value); err != nil {
+				return SearchQuery{}, err
+			}
+		default:
+			terms = append(terms, token)
+		}
+	}
+
+	if len(terms) == 0 {
+		return query, nil
+	}
+
+	p := &queryParser{tokens: terms}
+	node, err := p.parseOr()
+	if err != nil {
+		return SearchQuery{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return SearchQuery{}, fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, p.tokens[p.pos].text)
+	}
+
+	if node == nil {
+		return SearchQuery{}, fmt.Errorf("%w: nothing to search", ErrInvalidQuery)
+	}
+
+	if node.negative() {
+		query.Exclude, err = node.negation().fts()
+	} else {
+		query.Match, err = node.fts()
+	}
+	if err != nil {
+		return SearchQuery{}, err
+	}
+
+	return query, nil
+}
+
+func parseQueryDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid date %q, use YYYY-MM-DD or RFC3339", ErrInvalidQuery, value)
+	}
+
+	return t, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenPhrase
+	tokenOpen
+	tokenClose
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+}
+
+func lexQuery(q string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	runes := []rune(q)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenOpen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenClose, text: ")"})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, queryToken{kind: tokenNot, text: "-"})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("%w: unterminated phrase", ErrInvalidQuery)
+			}
+			tokens = append(tokens, queryToken{kind: tokenPhrase, text: string(runes[i+1 : end])})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(`()"`, runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+			switch word {
+			case "AND":
+				tokens = append(tokens, queryToken{kind: tokenAnd, text: word})
+			case "OR":
+				tokens = append(tokens, queryToken{kind: tokenOr, text: word})
+			case "NOT":
+				tokens = append(tokens, queryToken{kind: tokenNot, text: word})
+			default:
+				tokens = append(tokens, queryToken{kind: tokenWord, text: word})
+			}
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+type nodeKind int
+
+const (
+	nodeTerm nodeKind = iota
+	nodeAnd
+	nodeOr
+	nodeNot
+)
+
+type queryNode struct {
+	kind     nodeKind
+	term     string
+	children []*queryNode
+}
+
+// queryParser is a recursive descent parser where NOT binds tighter than AND, and AND tighter than OR
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) parseOr() (*queryNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token, ok := p.peek()
+		if !ok || token.kind != tokenOr {
+			return node, nil
+		}
+		p.pos++
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		node = combine(nodeOr, node, right)
+	}
+}
+
+func (p *queryParser) parseAnd() (*queryNode, error) {
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token, ok := p.peek()
+		if !ok || token.kind == tokenOr || token.kind == tokenClose {
+			return node, nil
+		}
+		if token.kind == tokenAnd {
+			p.pos++
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		node = combine(nodeAnd, node, right)
+	}
+}
+
+func (p *queryParser) parseUnary() (*queryNode, error) {
+	token, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected end of query", ErrInvalidQuery)
+	}
+
+	switch token.kind {
+	case tokenNot:
+		p.pos++
+		node, err := p.parseUnary()
+		if err != nil || node == nil {
+			return node, err
+		}
+		if node.kind == nodeNot {
+			return node.children[0], nil
+		}
+		return &queryNode{kind: nodeNot, children: []*queryNode{node}}, nil
+	case tokenOpen:
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if token, ok := p.peek(); !ok || token.kind != tokenClose {
+			return nil, fmt.Errorf("%w: missing closing parenthesis", ErrInvalidQuery)
+		}
+		p.pos++
+		return node, nil
+	case tokenWord, tokenPhrase:
+		p.pos++
+		return newTerm(token), nil
+	default:
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, token.text)
+	}
+}
+
+// newTerm returns the term matching a word or phrase, or nil when it holds nothing searchable
+func newTerm(token queryToken) *queryNode {
+	prefix := token.kind == tokenWord && strings.HasSuffix(token.text, "*")
+
+	words := strings.FieldsFunc(token.text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return nil
+	}
+
+	term := strings.Join(words, " ")
+	if prefix {
+		term += "*"
+	}
+
+	return &queryNode{kind: nodeTerm, term: term}
+}
+
+// combine joins two nodes, nil nodes come from terms holding nothing searchable and are dropped
+func combine(kind nodeKind, left, right *queryNode) *queryNode {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+
+	node := &queryNode{kind: kind}
+	for _, child := range []*queryNode{left, right} {
+		if child.kind == kind {
+			node.children = append(node.children, child.children...)
+		} else {
+			node.children = append(node.children, child)
+		}
+	}
+
+	return node
+}
+
+// negative tells whether a node only excludes bookmarks, such as NOT a or NOT a AND NOT b
+func (n *queryNode) negative() bool {
+	switch n.kind {
+	case nodeNot:
+		return true
+	case nodeAnd:
+		for _, child := range n.children {
+			if !child.negative() {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// negation returns the node matching the bookmarks a negative node excludes
+func (n *queryNode) negation() *queryNode {
+	if n.kind == nodeNot {
+		return n.children[0]
+	}
+
+	node := &queryNode{kind: nodeOr}
+	for _, child := range n.children {
+		node.children = append(node.children, child.negation())
+	}
+
+	return node
+}
+
+// fts renders a node using the FTS enhanced query syntax, where NOT is a binary operator
+func (n *queryNode) fts() (string, error) {
+	switch n.kind {
+	case nodeTerm:
+		return `"` + n.term + `"`, nil
+	case nodeOr:
+		parts := make([]string, 0, len(n.children))
+		for _, child := range n.children {
+			if child.negative() {
+				return "", fmt.Errorf("%w: NOT must be combined with a term using AND", ErrInvalidQuery)
+			}
+			part, err := child.fts()
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		return "(" + strings.Join(parts, " OR ") + ")", nil
+	case nodeAnd:
+		var include, exclude []string
+		for _, child := range n.children {
+			if child.kind == nodeNot {
+				part, err := child.children[0].fts()
+				if err != nil {
+					return "", err
+				}
+				exclude = append(exclude, part)
+				continue
+			}
+
+			part, err := child.fts()
+			if err != nil {
+				return "", err
+			}
+			include = append(include, part)
+		}
+		if len(include) == 0 {
+			return "", fmt.Errorf("%w: NOT must be combined with a term using AND", ErrInvalidQuery)
+		}
+
+		expr := "(" + strings.Join(include, " AND ")
+		for _, part := range exclude {
+			expr += " NOT " + part
+		}
+		return expr + ")", nil
+	default:
+		return "", fmt.Errorf("%w: NOT must be combined with a term using AND", ErrInvalidQuery)
+	}
+}
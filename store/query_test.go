@@ -0,0 +1,99 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+		want SearchQuery
+	}{
+		{"word", "golang", SearchQuery{Match: `"golang"`}},
+		{"words", "go rust", SearchQuery{Match: `("go" AND "rust")`}},
+		{"explicit AND", "go AND rust", SearchQuery{Match: `("go" AND "rust")`}},
+		{"phrase", `"hello world"`, SearchQuery{Match: `"hello world"`}},
+		{"phrase punctuation", `"hello, world!"`, SearchQuery{Match: `"hello world"`}},
+		{"prefix", "gopher*", SearchQuery{Match: `"gopher*"`}},
+		{"NOT", "go NOT rust", SearchQuery{Match: `("go" NOT "rust")`}},
+		{"minus", "go -rust", SearchQuery{Match: `("go" NOT "rust")`}},
+		{"double negation", "go NOT -rust", SearchQuery{Match: `("go" AND "rust")`}},
+		{"hyphenated word", "open-source", SearchQuery{Match: `"open source"`}},
+		{"OR", "go OR rust", SearchQuery{Match: `("go" OR "rust")`}},
+		{"AND before OR", "go OR rust zig", SearchQuery{Match: `("go" OR ("rust" AND "zig"))`}},
+		{"parentheses", "(go OR rust) zig", SearchQuery{Match: `(("go" OR "rust") AND "zig")`}},
+		{"NOT in OR", "(go -generics) OR rust", SearchQuery{Match: `(("go" NOT "generics") OR "rust")`}},
+		{"negative", "-rust", SearchQuery{Exclude: `"rust"`}},
+		{"negatives", "-rust NOT zig", SearchQuery{Exclude: `("rust" OR "zig")`}},
+		{"negative group", "-(rust OR zig)", SearchQuery{Exclude: `("rust" OR "zig")`}},
+		{"from", "from:@gopher go", SearchQuery{Match: `"go"`, BookmarkFilter: BookmarkFilter{Authors: []string{"gopher"}}}},
+		{"tag", "tag:lang go tag:news", SearchQuery{Match: `"go"`, BookmarkFilter: BookmarkFilter{Tags: []string{"lang", "news"}}}},
+		{"before", "before:2023-01-02 go", SearchQuery{Match: `"go"`, BookmarkFilter: BookmarkFilter{
+			Before: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+		}}},
+		{"after", "go after:2023-01-02T15:04:05Z", SearchQuery{Match: `"go"`, BookmarkFilter: BookmarkFilter{
+			After: time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC),
+		}}},
+		{"operators only", "from:gopher tag:lang", SearchQuery{BookmarkFilter: BookmarkFilter{
+			Authors: []string{"gopher"},
+			Tags:    []string{"lang"},
+		}}},
+		{"unknown operator", "site:go.dev", SearchQuery{Match: `"site go dev"`}},
+		{"empty", "", SearchQuery{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSearchQuery(tt.q, BookmarkFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSearchQuery(%q) = %+v, want %+v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchQueryKeepsFilter(t *testing.T) {
+	filter := BookmarkFilter{Authors: []string{"gopher"}, Lang: "en", Limit: 10}
+
+	got, err := ParseSearchQuery("from:rustacean go", filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := SearchQuery{Match: `"go"`, BookmarkFilter: BookmarkFilter{Authors: []string{"gopher", "rustacean"}, Lang: "en", Limit: 10}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseSearchQueryInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+	}{
+		{"unterminated phrase", `"hello world`},
+		{"missing closing parenthesis", "(go OR rust"},
+		{"unexpected closing parenthesis", "go)"},
+		{"leading OR", "OR go"},
+		{"trailing OR", "go OR"},
+		{"trailing NOT", "go NOT"},
+		{"negative in OR", "go OR -rust"},
+		{"nothing to search", "!!!"},
+		{"invalid date", "before:yesterday go"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSearchQuery(tt.q, BookmarkFilter{}); !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("ParseSearchQuery(%q) err = %v, want ErrInvalidQuery", tt.q, err)
+			}
+		})
+	}
+}
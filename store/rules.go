@@ -0,0 +1,521 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"twitter-bookmarks/models"
+)
+
+var (
+	// ErrRuleNotFound is returned when a rule does not exist for an account
+	ErrRuleNotFound = fmt.Errorf("rule %w", ErrNotFound)
+	// ErrInvalidRule is returned when the conditions or actions of a rule are invalid
+	ErrInvalidRule = errors.New("invalid rule")
+)
+
+// maxRuleNameLength is the maximum number of characters of a rule name
+const maxRuleNameLength = 100
+
+// mediaKeyTypes maps the prefix of a media key to the type of the media
+var mediaKeyTypes = map[string]string{
+	"3":  "photo",
+	"7":  "video",
+	"13": "video",
+	"16": "animated_gif",
+}
+
+// NormalizeRule checks the name, conditions and actions of a rule, lower casing the values
+// compared case insensitively and dropping duplicates
+func NormalizeRule(rule *models.Rule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if utf8.RuneCountInString(rule.Name) > maxRuleNameLength {
+		return fmt.Errorf("%w: names are limited to %d characters", ErrInvalidRule, maxRuleNameLength)
+	}
+
+	match := &rule.Match
+	match.Authors = normalizeValues(match.Authors, "@")
+	match.Keywords = normalizeValues(match.Keywords, "")
+	match.Domains = normalizeValues(match.Domains, "")
+	match.Hashtags = normalizeValues(match.Hashtags, "#")
+	match.MediaTypes = normalizeValues(match.MediaTypes, "")
+
+	for _, mediaType := range match.MediaTypes {
+		if mediaType != "photo" && mediaType != "video" && mediaType != "animated_gif" {
+			return fmt.Errorf("%w: media type %q must be photo, video or animated_gif", ErrInvalidRule, mediaType)
+		}
+	}
+
+	if match.Pattern != "" {
+		if _, err := regexp.Compile(match.Pattern); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+	}
+
+	if len(match.Authors)+len(match.Keywords)+len(match.Domains)+len(match.Hashtags)+len(match.MediaTypes) == 0 && match.Pattern == "" {
+		return fmt.Errorf("%w: a rule needs at least one condition", ErrInvalidRule)
+	}
+
+	tags, err := NormalizeTags(rule.Actions.Tags)
+	if err != nil {
+		return err
+	}
+	rule.Actions.Tags = tags
+
+	collections := make([]int64, 0, len(rule.Actions.Collections))
+	for _, id := range rule.Actions.Collections {
+		if !containsID(collections, id) {
+			collections = append(collections, id)
+		}
+	}
+	rule.Actions.Collections = collections
+
+	if len(rule.Actions.Tags) == 0 && len(rule.Actions.Collections) == 0 {
+		return fmt.Errorf("%w: a rule needs at least one tag or collection to apply", ErrInvalidRule)
+	}
+
+	return nil
+}
+
+const ruleColumns = `id, name, enabled, conditions, actions, created_at, updated_at`
+
+func scanRule(row scanner) (*models.Rule, error) {
+	var (
+		rule                 models.Rule
+		conditions, actions  []byte
+		createdAt, updatedAt int64
+	)
+
+	if err := row.Scan(&rule.ID, &rule.Name, &rule.Enabled, &conditions, &actions, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(conditions, &rule.Match); err != nil {
+		return nil, fmt.Errorf("failed to decode rule conditions: %w", err)
+	}
+	if err := json.Unmarshal(actions, &rule.Actions); err != nil {
+		return nil, fmt.Errorf("failed to decode rule actions: %w", err)
+	}
+
+	rule.CreatedAt = fromUnix(createdAt)
+	rule.UpdatedAt = fromUnix(updatedAt)
+
+	return &rule, nil
+}
+
+// ListRules returns the rules of an account in their creation order
+func (s *SQLiteStore) ListRules(ctx context.Context, userID string) ([]models.Rule, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+ruleColumns+` FROM rules WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make([]models.Rule, 0)
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rule: %w", err)
+		}
+		rules = append(rules, *rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// GetRule returns a rule of an account
+func (s *SQLiteStore) GetRule(ctx context.Context, userID string, id int64) (*models.Rule, error) {
+	rule, err := scanRule(s.db.QueryRowContext(ctx, `SELECT `+ruleColumns+` FROM rules WHERE user_id = ? AND id = ?`, userID, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRuleNotFound
+		}
+		return nil, fmt.Errorf("failed to get rule: %w", err)
+	}
+
+	return rule, nil
+}
+
+// CreateRule normalizes and saves a new rule of an account, setting its ID
+func (s *SQLiteStore) CreateRule(ctx context.Context, userID string, rule *models.Rule, now time.Time) error {
+	return s.saveRule(ctx, userID, rule, now, func(tx *sql.Tx, conditions, actions []byte) error {
+		result, err := tx.ExecContext(ctx, `INSERT INTO rules (user_id, name, enabled, conditions, actions, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, userID, rule.Name, rule.Enabled, conditions, actions, toUnix(now), toUnix(now))
+		if err != nil {
+			return fmt.Errorf("failed to create rule: %w", err)
+		}
+
+		if rule.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to create rule: %w", err)
+		}
+		rule.CreatedAt = fromUnix(toUnix(now))
+
+		return nil
+	})
+}
+
+// UpdateRule normalizes and replaces a rule of an account
+func (s *SQLiteStore) UpdateRule(ctx context.Context, userID string, rule *models.Rule, now time.Time) error {
+	return s.saveRule(ctx, userID, rule, now, func(tx *sql.Tx, conditions, actions []byte) error {
+		result, err := tx.ExecContext(ctx, `UPDATE rules SET name = ?, enabled = ?, conditions = ?, actions = ?, updated_at = ?
+			WHERE user_id = ? AND id = ?`, rule.Name, rule.Enabled, conditions, actions, toUnix(now), userID, rule.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update rule: %w", err)
+		}
+
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to update rule: %w", err)
+		}
+		if updated == 0 {
+			return ErrRuleNotFound
+		}
+
+		return nil
+	})
+}
+
+// saveRule normalizes a rule and checks its collections belong to the account before calling save
+// in a transaction with the encoded conditions and actions
+func (s *SQLiteStore) saveRule(ctx context.Context, userID string, rule *models.Rule, now time.Time, save func(tx *sql.Tx, conditions, actions []byte) error) error {
+	if err := NormalizeRule(rule); err != nil {
+		return err
+	}
+
+	conditions, err := json.Marshal(rule.Match)
+	if err != nil {
+		return fmt.Errorf("failed to encode rule conditions: %w", err)
+	}
+
+	actions, err := json.Marshal(rule.Actions)
+	if err != nil {
+		return fmt.Errorf("failed to encode rule actions: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, id := range rule.Actions.Collections {
+		if err := collectionExists(ctx, tx, userID, id); err != nil {
+			if errors.Is(err, ErrCollectionNotFound) {
+				return fmt.Errorf("%w: unknown collection %d", ErrInvalidRule, id)
+			}
+			return err
+		}
+	}
+
+	if err := save(tx, conditions, actions); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rule: %w", err)
+	}
+	rule.UpdatedAt = fromUnix(toUnix(now))
+
+	return nil
+}
+
+// DeleteRule deletes a rule of an account, the tags and collections it applied are kept
+func (s *SQLiteStore) DeleteRule(ctx context.Context, userID string, id int64) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM rules WHERE user_id = ? AND id = ?`, userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete rule: %w", err)
+	}
+	if deleted == 0 {
+		return ErrRuleNotFound
+	}
+
+	return nil
+}
+
+// MatchRules returns the archived bookmarks tweetIDs of an account matched by each rule, nil
+// tweetIDs match every archived bookmark
+func (s *SQLiteStore) MatchRules(ctx context.Context, userID string, rules []models.Rule, tweetIDs []string) ([]models.RuleMatches, error) {
+	matchers, err := newRuleMatchers(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + bookmarkColumns + ` FROM bookmarks b WHERE b.user_id = ?`
+	args := []any{userID}
+	if tweetIDs != nil {
+		if len(tweetIDs) == 0 {
+			return emptyMatches(rules), nil
+		}
+
+		query += ` AND b.tweet_id IN (` + placeholders(len(tweetIDs)) + `)`
+		for _, id := range tweetIDs {
+			args = append(args, id)
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY b.first_seen_at DESC, b.rowid ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bookmarks: %w", err)
+	}
+	defer rows.Close()
+
+	matches := emptyMatches(rules)
+	for rows.Next() {
+		bookmark, err := scanBookmark(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan bookmark: %w", err)
+		}
+
+		for i, matcher := range matchers {
+			if matcher.matches(*bookmark) {
+				matches[i].TweetIDs = append(matches[i].TweetIDs, bookmark.TweetID)
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query bookmarks: %w", err)
+	}
+
+	return matches, nil
+}
+
+// ApplyRules tags and collects the archived bookmarks tweetIDs of an account matched by each rule,
+// nil tweetIDs apply the rules to every archived bookmark. Collections deleted since a rule was
+// saved are skipped.
+func (s *SQLiteStore) ApplyRules(ctx context.Context, userID string, rules []models.Rule, tweetIDs []string, now time.Time) ([]models.RuleMatches, error) {
+	matches, err := s.MatchRules(ctx, userID, rules, tweetIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := applyRules(ctx, tx, userID, rules, matches, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit rules: %w", err)
+	}
+
+	return matches, nil
+}
+
+// applyRules tags and collects the bookmarks matched by each rule, skipping deleted collections
+func applyRules(ctx context.Context, tx *sql.Tx, userID string, rules []models.Rule, matches []models.RuleMatches, now time.Time) error {
+	for i, rule := range rules {
+		for _, tweetID := range matches[i].TweetIDs {
+			for _, tag := range rule.Actions.Tags {
+				_, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO bookmark_tags (user_id, tweet_id, tag, created_at)
+					VALUES (?, ?, ?, ?)`, userID, tweetID, tag, toUnix(now))
+				if err != nil {
+					return fmt.Errorf("failed to tag %s: %w", tweetID, err)
+				}
+			}
+
+			for _, id := range rule.Actions.Collections {
+				_, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO collection_bookmarks (collection_id, tweet_id, position, added_at)
+					SELECT c.id, ?, (SELECT count(*) FROM collection_bookmarks cb WHERE cb.collection_id = c.id), ?
+					FROM collections c WHERE c.user_id = ? AND c.id = ?`, tweetID, toUnix(now), userID, id)
+				if err != nil {
+					return fmt.Errorf("failed to add %s to collection: %w", tweetID, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func emptyMatches(rules []models.Rule) []models.RuleMatches {
+	matches := make([]models.RuleMatches, 0, len(rules))
+	for _, rule := range rules {
+		matches = append(matches, models.RuleMatches{RuleID: rule.ID, TweetIDs: []string{}})
+	}
+
+	return matches
+}
+
+// ruleMatcher matches bookmarks against the normalized conditions of a rule
+type ruleMatcher struct {
+	conditions models.RuleConditions
+	pattern    *regexp.Regexp
+}
+
+func newRuleMatchers(rules []models.Rule) ([]*ruleMatcher, error) {
+	matchers := make([]*ruleMatcher, 0, len(rules))
+	for _, rule := range rules {
+		matcher, err := newRuleMatcher(rule)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	return matchers, nil
+}
+
+func newRuleMatcher(rule models.Rule) (*ruleMatcher, error) {
+	m := &ruleMatcher{conditions: rule.Match}
+	if rule.Match.Pattern != "" {
+		pattern, err := regexp.Compile(rule.Match.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+		m.pattern = pattern
+	}
+
+	return m, nil
+}
+
+func (m *ruleMatcher) matches(bookmark models.Bookmark) bool {
+	c := m.conditions
+
+	if len(c.Authors) > 0 && !contains(c.Authors, strings.ToLower(bookmark.Author.Username)) {
+		return false
+	}
+
+	if len(c.Keywords) > 0 {
+		text := strings.ToLower(bookmark.Text)
+		found := false
+		for _, keyword := range c.Keywords {
+			if strings.Contains(text, keyword) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if m.pattern != nil && !m.pattern.MatchString(bookmark.Text) {
+		return false
+	}
+
+	if len(c.Domains) > 0 && !intersects(c.Domains, linkedDomains(bookmark), matchesDomain) {
+		return false
+	}
+
+	if len(c.Hashtags) > 0 && !intersects(c.Hashtags, hashtags(bookmark), strings.EqualFold) {
+		return false
+	}
+
+	if len(c.MediaTypes) > 0 && !intersects(c.MediaTypes, mediaTypes(bookmark), strings.EqualFold) {
+		return false
+	}
+
+	return true
+}
+
+// intersects tells whether any of wanted matches any of values
+func intersects(wanted, values []string, match func(want, value string) bool) bool {
+	for _, want := range wanted {
+		for _, value := range values {
+			if match(want, value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchesDomain tells whether host is domain or one of its subdomains
+func matchesDomain(domain, host string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func linkedDomains(bookmark models.Bookmark) []string {
+	domains := make([]string, 0, len(bookmark.Entities.URLs))
+	for _, link := range bookmark.Entities.URLs {
+		raw := link.UnwoundURL
+		if raw == "" {
+			raw = link.ExpandedURL
+		}
+		if raw == "" {
+			raw = link.URL
+		}
+
+		if u, err := url.Parse(raw); err == nil && u.Hostname() != "" {
+			domains = append(domains, strings.ToLower(u.Hostname()))
+		}
+	}
+
+	return domains
+}
+
+func hashtags(bookmark models.Bookmark) []string {
+	tags := make([]string, 0, len(bookmark.Entities.Hashtags))
+	for _, hashtag := range bookmark.Entities.Hashtags {
+		tags = append(tags, hashtag.Tag)
+	}
+
+	return tags
+}
+
+// mediaTypes returns the types of the media attached to a bookmark, read from the prefix of their
+// keys for bookmarks archived before their media were fetched
+func mediaTypes(bookmark models.Bookmark) []string {
+	types := make([]string, 0, len(bookmark.Attachments.MediaKeys))
+	if len(bookmark.Media) > 0 {
+		for _, media := range bookmark.Media {
+			types = append(types, media.Type)
+		}
+		return types
+	}
+
+	for _, key := range bookmark.Attachments.MediaKeys {
+		prefix, _, _ := strings.Cut(key, "_")
+		if mediaType, ok := mediaKeyTypes[prefix]; ok {
+			types = append(types, mediaType)
+		}
+	}
+
+	return types
+}
+
+// normalizeValues trims, lower cases and drops the prefix of values, dropping empty values and duplicates
+func normalizeValues(values []string, prefix string) []string {
+	normalized := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(value), prefix))
+		if value != "" && !contains(normalized, value) {
+			normalized = append(normalized, value)
+		}
+	}
+
+	return normalized
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+
+	return false
+}
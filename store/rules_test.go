@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+)
+
+func TestNormalizeRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule models.Rule
+		want models.Rule
+	}{
+		{
+			"authors",
+			models.Rule{Name: " go news ", Match: models.RuleConditions{Authors: []string{"@Gopher", "gopher", " ", "golang"}},
+				Actions: models.RuleActions{Tags: []string{"Go"}}},
+			models.Rule{Name: "go news", Match: models.RuleConditions{Authors: []string{"gopher", "golang"}},
+				Actions: models.RuleActions{Tags: []string{"go"}, Collections: []int64{}}},
+		},
+		{
+			"keywords and pattern",
+			models.Rule{Match: models.RuleConditions{Keywords: []string{"Generics", "generics "}, Pattern: `(?i)go\s*1\.\d+`},
+				Actions: models.RuleActions{Collections: []int64{2, 1, 2}}},
+			models.Rule{Match: models.RuleConditions{Keywords: []string{"generics"}, Pattern: `(?i)go\s*1\.\d+`},
+				Actions: models.RuleActions{Tags: []string{}, Collections: []int64{2, 1}}},
+		},
+		{
+			"links and media",
+			models.Rule{Match: models.RuleConditions{Domains: []string{"Go.dev"}, Hashtags: []string{"#GoLang", "golang"},
+				MediaTypes: []string{"Photo", "video"}}, Actions: models.RuleActions{Tags: []string{"news", "go", "news"}}},
+			models.Rule{Match: models.RuleConditions{Domains: []string{"go.dev"}, Hashtags: []string{"golang"},
+				MediaTypes: []string{"photo", "video"}}, Actions: models.RuleActions{Tags: []string{"go", "news"}, Collections: []int64{}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NormalizeRule(&tt.rule); err != nil {
+				t.Fatal(err)
+			}
+			// empty and nil lists are alike
+			if got, want := fmt.Sprintf("%+v", tt.rule), fmt.Sprintf("%+v", tt.want); got != want {
+				t.Errorf("NormalizeRule = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestNormalizeRuleInvalid(t *testing.T) {
+	tag := models.RuleActions{Tags: []string{"go"}}
+
+	tests := []struct {
+		name string
+		rule models.Rule
+		want error
+	}{
+		{"long name", models.Rule{Name: strings.Repeat("a", maxRuleNameLength+1),
+			Match: models.RuleConditions{Keywords: []string{"go"}}, Actions: tag}, ErrInvalidRule},
+		{"no condition", models.Rule{Match: models.RuleConditions{Authors: []string{"@"}}, Actions: tag}, ErrInvalidRule},
+		{"unknown media type", models.Rule{Match: models.RuleConditions{MediaTypes: []string{"audio"}}, Actions: tag}, ErrInvalidRule},
+		{"invalid pattern", models.Rule{Match: models.RuleConditions{Pattern: "go("}, Actions: tag}, ErrInvalidRule},
+		{"no action", models.Rule{Match: models.RuleConditions{Keywords: []string{"go"}}}, ErrInvalidRule},
+		{"invalid tag", models.Rule{Match: models.RuleConditions{Keywords: []string{"go"}},
+			Actions: models.RuleActions{Tags: []string{"go,rust"}}}, ErrInvalidTag},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NormalizeRule(&tt.rule); !errors.Is(err, tt.want) {
+				t.Errorf("NormalizeRule err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// ruleBookmarks returns bookmarks exercising every condition of the rules
+func ruleBookmarks() []models.Bookmark {
+	generics := testBookmark("1", "Go 1.18 brings Generics")
+	generics.Entities.Hashtags = []models.HashtagEntity{{Tag: "GoLang"}}
+
+	blog := testBookmark("2", "A new post on the blog")
+	blog.Author = models.Author{ID: "200", Username: "GoDev"}
+	blog.Entities.URLs = []models.URLEntity{{URL: "https://t.co/a", ExpandedURL: "https://blog.go.dev/post"}}
+
+	photo := testBookmark("3", "Look at this gopher")
+	photo.Attachments.MediaKeys = []string{"3_1"}
+	photo.Media = []models.Media{{MediaKey: "3_1", Type: "photo"}}
+
+	video := testBookmark("4", "Rust in 100 seconds")
+	video.Author = models.Author{ID: "300", Username: "rustacean"}
+	video.Attachments.MediaKeys = []string{"7_1"}
+	video.Entities.URLs = []models.URLEntity{{URL: "https://t.co/b", ExpandedURL: "https://notgo.dev"}}
+
+	return []models.Bookmark{generics, blog, photo, video}
+}
+
+func TestMatchRules(t *testing.T) {
+	s := newTestStore(t)
+	saveBookmarks(t, s, ruleBookmarks()...)
+
+	tests := []struct {
+		name  string
+		match models.RuleConditions
+		want  []string
+	}{
+		{"author", models.RuleConditions{Authors: []string{"@godev", "rustacean"}}, []string{"2", "4"}},
+		{"keyword", models.RuleConditions{Keywords: []string{"generics", "blog"}}, []string{"1", "2"}},
+		{"regex", models.RuleConditions{Pattern: `\d+ seconds|1\.\d+`}, []string{"1", "4"}},
+		{"domain and subdomains", models.RuleConditions{Domains: []string{"go.dev"}}, []string{"2"}},
+		{"hashtag", models.RuleConditions{Hashtags: []string{"#golang"}}, []string{"1"}},
+		{"media type", models.RuleConditions{MediaTypes: []string{"photo"}}, []string{"3"}},
+		{"media type from key", models.RuleConditions{MediaTypes: []string{"video"}}, []string{"4"}},
+		{"every condition", models.RuleConditions{Authors: []string{"gopher"}, Keywords: []string{"gopher", "generics"}}, []string{"1", "3"}},
+		{"no match", models.RuleConditions{Authors: []string{"gopher"}, MediaTypes: []string{"video"}}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := models.Rule{ID: 1, Match: tt.match, Actions: models.RuleActions{Tags: []string{"matched"}}}
+			if err := NormalizeRule(&rule); err != nil {
+				t.Fatal(err)
+			}
+
+			matches, err := s.MatchRules(context.Background(), testUserID, []models.Rule{rule}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := matches[0].TweetIDs
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchRulesDoesNotApply(t *testing.T) {
+	s := newTestStore(t)
+	saveBookmarks(t, s, ruleBookmarks()...)
+
+	rule := models.Rule{ID: 1, Match: models.RuleConditions{Keywords: []string{"gopher"}}, Actions: models.RuleActions{Tags: []string{"gopher"}}}
+	matches, err := s.MatchRules(context.Background(), testUserID, []models.Rule{rule}, []string{"1", "3", "4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"3"}; !reflect.DeepEqual(matches[0].TweetIDs, want) {
+		t.Errorf("matched %v, want %v", matches[0].TweetIDs, want)
+	}
+
+	tags, err := s.ListTags(context.Background(), testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 0 {
+		t.Errorf("matching tagged bookmarks: %v", tags)
+	}
+}
+
+func TestSaveBookmarksAppliesRules(t *testing.T) {
+	ctx, now := context.Background(), time.Now()
+	s := newTestStore(t)
+	saveBookmarks(t, s, testBookmark("1", "an old gopher"))
+
+	collection, err := s.CreateCollection(ctx, testUserID, "gophers", "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := models.Rule{ID: 1, Match: models.RuleConditions{Keywords: []string{"gopher"}},
+		Actions: models.RuleActions{Tags: []string{"gopher"}, Collections: []int64{collection.ID}}}
+
+	bookmarks := []models.Bookmark{testBookmark("1", "an old gopher"), testBookmark("2", "a new gopher"), testBookmark("3", "a new rustacean")}
+	matches, err := s.SaveBookmarks(ctx, testUserID, bookmarks, []models.Rule{rule}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []models.RuleMatches{{RuleID: 1, TweetIDs: []string{"2"}}}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("matches = %+v, want the new bookmark only %+v", matches, want)
+	}
+
+	for tweetID, want := range map[string][]string{"1": nil, "2": {"gopher"}, "3": nil} {
+		bookmark, err := s.GetBookmark(ctx, testUserID, tweetID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(bookmark.Tags, want) {
+			t.Errorf("bookmark %s tags = %v, want %v", tweetID, bookmark.Tags, want)
+		}
+	}
+	if got, want := collectionOrder(t, s, collection.ID), []string{"2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("collection = %v, want %v", got, want)
+	}
+
+	// an invalid rule leaves the page unsaved
+	invalid := models.Rule{ID: 2, Match: models.RuleConditions{Pattern: "go("}}
+	if _, err := s.SaveBookmarks(ctx, testUserID, []models.Bookmark{testBookmark("4", "gopher")}, []models.Rule{invalid}, now); err == nil {
+		t.Fatal("bookmarks saved with an invalid rule")
+	}
+	if _, err := s.GetBookmark(ctx, testUserID, "4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("bookmark saved without its rules: err = %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+
+	"twitter-bookmarks/models"
+)
+
+// snippetTokens is the number of tokens of the text around the matches kept in a snippet
+const snippetTokens = 32
+
+// SearchBookmarks returns the archived bookmarks of an account matching query. Bookmarks are ranked
+// by relevance when the query matches terms and no sort order is requested.
+func (s *SQLiteStore) SearchBookmarks(ctx context.Context, userID string, query SearchQuery) (*models.SearchResponse, error) {
+	where, args := query.conditions(userID)
+	if query.Exclude != "" {
+		where += ` AND b.rowid NOT IN (SELECT docid FROM bookmarks_fts WHERE bookmarks_fts MATCH ?)`
+		args = append(args, query.Exclude)
+	}
+
+	var (
+		results []models.SearchResult
+		err     error
+	)
+	switch {
+	case query.Match == "":
+		results, err = s.queryResults(ctx, `SELECT b.text, NULL, `+bookmarkColumns+` FROM bookmarks b WHERE `+where+`
+			ORDER BY `+query.orderBy()+` LIMIT ? OFFSET ?`, append(args, query.Limit+1, query.Offset)...)
+	case query.Sort != "":
+		results, err = s.queryResults(ctx, matchQuery+where+` ORDER BY `+query.orderBy()+` LIMIT ? OFFSET ?`,
+			append(append([]any{snippetTokens, query.Match}, args...), query.Limit+1, query.Offset)...)
+	default:
+		results, err = s.queryResults(ctx, matchQuery+where+` ORDER BY rank(matchinfo(bookmarks_fts, 'pcnx')) DESC, b.created_at DESC, b.tweet_id DESC
+			LIMIT ? OFFSET ?`, append(append([]any{snippetTokens, query.Match}, args...), query.Limit+1, query.Offset)...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to search bookmarks: %w", err)
+	}
+
+	response := &models.SearchResponse{Results: results}
+	if len(results) > query.Limit {
+		response.Results = results[:query.Limit]
+		response.NextCursor = strconv.Itoa(query.Offset + query.Limit)
+	}
+
+	return response, nil
+}
+
+// matchQuery selects the snippet and match info of the bookmarks matching an FTS expression,
+// its parameters are the snippet size and the expression
+const matchQuery = `SELECT snippet(bookmarks_fts, '<mark>', '</mark>', '…', -1, ?), matchinfo(bookmarks_fts, 'pcnx'),
+	` + bookmarkColumns + ` FROM bookmarks_fts JOIN bookmarks b ON b.rowid = bookmarks_fts.docid
+	WHERE bookmarks_fts MATCH ? AND `
+
+// queryResults runs a query selecting a snippet, the match info then bookmarkColumns
+func (s *SQLiteStore) queryResults(ctx context.Context, query string, args ...any) ([]models.SearchResult, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]models.SearchResult, 0)
+	for rows.Next() {
+		var (
+			result    models.SearchResult
+			matchInfo []byte
+		)
+
+		bookmark, err := scanBookmark(rows, &result.Snippet, &matchInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Bookmark = *bookmark
+		result.Score = rank(matchInfo)
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// rank scores a match with tf-idf and is registered as the rank SQL function. matchInfo is the
+// FTS matchinfo 'pcnx' blob of 32-bit integers in the machine byte order, little endian on every
+// platform we run on: the number of phrases, the number of columns, the number of rows, then for
+// each phrase and column the hits in this row, the hits in every row and the number of rows with a
+// hit. Each phrase and column adds hits/(hits+1) * ln(1 + rows/matching rows), rounded to 3 decimals.
+func rank(matchInfo []byte) float64 {
+	values := make([]float64, len(matchInfo)/4)
+	for i := range values {
+		values[i] = float64(binary.LittleEndian.Uint32(matchInfo[i*4:]))
+	}
+	if len(values) < 3 {
+		return 0
+	}
+
+	phrases, columns, rows := int(values[0]), int(values[1]), values[2]
+	hits := values[3:]
+	if len(hits) < 3*phrases*columns {
+		return 0
+	}
+
+	var score float64
+	for i := 0; i < phrases*columns; i++ {
+		rowHits, matchingRows := hits[3*i], hits[3*i+2]
+		if rowHits == 0 || matchingRows == 0 {
+			continue
+		}
+		score += rowHits / (rowHits + 1) * math.Log(1+rows/matchingRows)
+	}
+
+	return math.Round(score*1000) / 1000
+}
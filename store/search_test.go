@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func search(t *testing.T, s *SQLiteStore, q string, filter BookmarkFilter) []string {
+	t.Helper()
+
+	query, err := ParseSearchQuery(q, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := s.SearchBookmarks(context.Background(), testUserID, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resultIDs(response.Results)
+}
+
+func TestSearchBookmarks(t *testing.T) {
+	s := newTestStore(t)
+	saveBookmarks(t, s,
+		testBookmark("1", "Go generics are here"),
+		testBookmark("2", "Rust ownership explained"),
+		testBookmark("3", "Go or Rust for your next service"),
+		testBookmark("4", "Gophers everywhere"),
+	)
+
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"rust", []string{"2", "3"}},
+		{"go rust", []string{"3"}},
+		{"go -rust", []string{"1"}},
+		{"go OR ownership", []string{"1", "2", "3"}},
+		{"gopher*", []string{"4"}},
+		{`"next service"`, []string{"3"}},
+		{"-go", []string{"2", "4"}},
+		{"zig", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			got := search(t, s, tt.q, BookmarkFilter{Sort: SortBookmarkedAt, Limit: 10})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("search %q = %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchBookmarksRanked(t *testing.T) {
+	s := newTestStore(t)
+	saveBookmarks(t, s,
+		testBookmark("1", "a note about go"),
+		testBookmark("2", "go go go"),
+		testBookmark("3", "nothing to see"),
+		testBookmark("4", "go go, said the gopher"),
+		testBookmark("5", "go"),
+	)
+
+	query, err := ParseSearchQuery("go", BookmarkFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := s.SearchBookmarks(context.Background(), testUserID, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := resultIDs(response.Results), []string{"2", "4"}; !reflect.DeepEqual(got[:2], want) {
+		t.Errorf("ranked %v, want %v first", got, want)
+	}
+	for i := 1; i < len(response.Results); i++ {
+		if response.Results[i].Score > response.Results[i-1].Score {
+			t.Errorf("results not sorted by score: %v", response.Results)
+		}
+	}
+
+	// the pages of a ranked search follow each other
+	var paged []string
+	for query.Offset, query.Limit = 0, 1; ; query.Offset++ {
+		response, err := s.SearchBookmarks(context.Background(), testUserID, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, resultIDs(response.Results)...)
+		if response.NextCursor == "" {
+			break
+		}
+	}
+	if want := resultIDs(response.Results); !reflect.DeepEqual(paged, want) {
+		t.Errorf("paged = %v, want %v", paged, want)
+	}
+}
+
+// TestSearchBookmarksParsedQueries checks every parsed query is a valid FTS expression
+func TestSearchBookmarksParsedQueries(t *testing.T) {
+	s := newTestStore(t)
+	saveBookmarks(t, s, testBookmark("1", "Go generics are here"))
+
+	queries := []string{
+		`go`, `"go`, `go"`, `"`, `""`, `*`, `go*`, `*go`, `go**`, `go*rust`, `-`, `--go`, `- go`, `NOT`,
+		`NOT NOT go`, `AND`, `OR`, `go AND`, `(`, `)`, `()`, `(go)`, `((go)`, `go OR OR rust`, `go NEAR rust`,
+		`go NEAR/2 rust`, `go^`, `text:go`, `note:go`, `"go" rust*`, `-"go rust"`, `-(go OR rust) zig`, `'go'`,
+		`go:`, `:go`, `from:`, `tag:`, `go & rust`, `go | rust`, `日本語`, `émigré*`,
+	}
+
+	for _, q := range queries {
+		query, err := ParseSearchQuery(q, BookmarkFilter{Limit: 10})
+		if err != nil {
+			if !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("ParseSearchQuery(%q) err = %v, want ErrInvalidQuery", q, err)
+			}
+			continue
+		}
+
+		if _, err := s.SearchBookmarks(context.Background(), testUserID, query); err != nil {
+			t.Errorf("search %q: %v", q, err)
+		}
+	}
+}
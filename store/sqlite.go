@@ -0,0 +1,403 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"twitter-bookmarks/models"
+)
+
+// migrations are applied in order when the store is created, the index of the last applied
+// migration is tracked in the database user_version. Only ever append to this list.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		username TEXT NOT NULL,
+		name TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS tokens (
+		user_id TEXT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+		access_token TEXT NOT NULL,
+		refresh_token TEXT NOT NULL,
+		expiry INTEGER NOT NULL,
+		scopes TEXT NOT NULL
+	)`,
+	`ALTER TABLE users ADD COLUMN description TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN profile_image_url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN location TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN verified INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN protected INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN followers_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN following_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN tweet_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN listed_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0`,
+	`CREATE TABLE bookmarks (
+		user_id TEXT NOT NULL,
+		tweet_id TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		author_id TEXT NOT NULL,
+		data TEXT NOT NULL,
+		first_seen_at INTEGER NOT NULL,
+		last_seen_at INTEGER NOT NULL,
+		PRIMARY KEY (user_id, tweet_id)
+	);
+	CREATE INDEX bookmarks_user_first_seen ON bookmarks (user_id, first_seen_at)`,
+	`ALTER TABLE bookmarks ADD COLUMN removed_at INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE bookmark_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		tweet_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		occurred_at INTEGER NOT NULL
+	);
+	CREATE INDEX bookmark_events_user_occurred ON bookmark_events (user_id, occurred_at)`,
+	`ALTER TABLE bookmarks ADD COLUMN text TEXT NOT NULL DEFAULT '';
+	ALTER TABLE bookmarks ADD COLUMN author_username TEXT NOT NULL DEFAULT '';
+	UPDATE bookmarks SET text = json_extract(data, '$.text'), author_username = json_extract(data, '$.author.username');
+	CREATE INDEX bookmarks_user_author ON bookmarks (user_id, author_username COLLATE NOCASE);
+	CREATE VIRTUAL TABLE bookmarks_fts USING fts4 (text, tokenize=unicode61);
+	INSERT INTO bookmarks_fts (docid, text) SELECT rowid, text FROM bookmarks;
+	CREATE TRIGGER bookmarks_fts_insert AFTER INSERT ON bookmarks BEGIN
+		INSERT INTO bookmarks_fts (docid, text) VALUES (new.rowid, new.text);
+	END;
+	CREATE TRIGGER bookmarks_fts_update AFTER UPDATE OF text ON bookmarks BEGIN
+		UPDATE bookmarks_fts SET text = new.text WHERE docid = new.rowid;
+	END;
+	CREATE TRIGGER bookmarks_fts_delete AFTER DELETE ON bookmarks BEGIN
+		DELETE FROM bookmarks_fts WHERE docid = old.rowid;
+	END`,
+	`ALTER TABLE bookmarks ADD COLUMN lang TEXT NOT NULL DEFAULT '';
+	ALTER TABLE bookmarks ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE bookmarks ADD COLUMN retweet_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE bookmarks ADD COLUMN has_media INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE bookmarks ADD COLUMN has_links INTEGER NOT NULL DEFAULT 0;
+	UPDATE bookmarks SET
+		lang = coalesce(json_extract(data, '$.lang'), ''),
+		like_count = coalesce(json_extract(data, '$.public_metrics.like_count'), 0),
+		retweet_count = coalesce(json_extract(data, '$.public_metrics.retweet_count'), 0),
+		has_media = coalesce(json_array_length(data, '$.attachments.media_keys'), 0) > 0,
+		has_links = coalesce(json_array_length(data, '$.entities.urls'), 0) > 0;
+	CREATE INDEX bookmarks_user_created ON bookmarks (user_id, created_at);
+	CREATE INDEX bookmarks_user_likes ON bookmarks (user_id, like_count)`,
+	`CREATE TABLE bookmark_tags (
+		user_id TEXT NOT NULL,
+		tweet_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (user_id, tweet_id, tag)
+	);
+	CREATE INDEX bookmark_tags_user_tag ON bookmark_tags (user_id, tag)`,
+	`ALTER TABLE bookmarks ADD COLUMN note TEXT NOT NULL DEFAULT '';
+	ALTER TABLE bookmarks ADD COLUMN highlights TEXT NOT NULL DEFAULT '[]';
+	ALTER TABLE bookmarks ADD COLUMN annotated_at INTEGER NOT NULL DEFAULT 0;
+	DROP TRIGGER bookmarks_fts_insert;
+	DROP TRIGGER bookmarks_fts_update;
+	DROP TRIGGER bookmarks_fts_delete;
+	DROP TABLE bookmarks_fts;
+	CREATE VIRTUAL TABLE bookmarks_fts USING fts4 (text, note, tokenize=unicode61);
+	INSERT INTO bookmarks_fts (docid, text, note) SELECT rowid, text, note FROM bookmarks;
+	CREATE TRIGGER bookmarks_fts_insert AFTER INSERT ON bookmarks BEGIN
+		INSERT INTO bookmarks_fts (docid, text, note) VALUES (new.rowid, new.text, new.note);
+	END;
+	CREATE TRIGGER bookmarks_fts_update AFTER UPDATE OF text, note ON bookmarks BEGIN
+		UPDATE bookmarks_fts SET text = new.text, note = new.note WHERE docid = new.rowid;
+	END;
+	CREATE TRIGGER bookmarks_fts_delete AFTER DELETE ON bookmarks BEGIN
+		DELETE FROM bookmarks_fts WHERE docid = old.rowid;
+	END`,
+	`CREATE TABLE collections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		position INTEGER NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE UNIQUE INDEX collections_user_name ON collections (user_id, name COLLATE NOCASE);
+	CREATE TABLE collection_bookmarks (
+		collection_id INTEGER NOT NULL REFERENCES collections (id) ON DELETE CASCADE,
+		tweet_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		added_at INTEGER NOT NULL,
+		PRIMARY KEY (collection_id, tweet_id)
+	)`,
+	`CREATE TABLE rules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		enabled INTEGER NOT NULL,
+		conditions TEXT NOT NULL,
+		actions TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX rules_user ON rules (user_id)`,
+	`CREATE TABLE media_files (
+		url TEXT PRIMARY KEY,
+		hash TEXT NOT NULL,
+		mime_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		attempts INTEGER NOT NULL,
+		error TEXT NOT NULL,
+		mirrored_at INTEGER NOT NULL
+	);
+	CREATE INDEX media_files_hash ON media_files (hash)`,
+	`CREATE TABLE threads (
+		user_id TEXT NOT NULL,
+		conversation_id TEXT NOT NULL,
+		author_id TEXT NOT NULL,
+		tweets TEXT NOT NULL,
+		expanded_at INTEGER NOT NULL,
+		PRIMARY KEY (user_id, conversation_id, author_id)
+	)`,
+}
+
+const userColumns = `id, username, name, description, profile_image_url, location, url, verified, protected,
+	created_at, followers_count, following_count, tweet_count, listed_count, updated_at`
+
+// driverName is the SQLite driver registering the functions the queries of the store use
+const driverName = "sqlite3_bookmarks"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("rank", rank, true)
+		},
+	})
+}
+
+// OpenSQLite opens the SQLite database at path
+func OpenSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on", path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return db, nil
+}
+
+// SQLiteStore stores the accounts in a SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore creates a store using db, migrating its schema when needed
+func NewSQLiteStore(ctx context.Context, db *sql.DB) (*SQLiteStore, error) {
+	if err := migrate(ctx, db); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (*models.User, error) {
+	var (
+		user                 models.User
+		createdAt, updatedAt int64
+	)
+
+	err := row.Scan(&user.ID, &user.Username, &user.Name, &user.Description, &user.ProfileImageURL, &user.Location,
+		&user.URL, &user.Verified, &user.Protected, &createdAt, &user.PublicMetrics.FollowersCount,
+		&user.PublicMetrics.FollowingCount, &user.PublicMetrics.TweetCount, &user.PublicMetrics.ListedCount, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	user.CreatedAt = fromUnix(createdAt)
+	user.UpdatedAt = fromUnix(updatedAt)
+
+	return &user, nil
+}
+
+// GetUser returns the account with the given Twitter user ID
+func (s *SQLiteStore) GetUser(ctx context.Context, id string) (*models.User, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// ListUsers returns every account ordered by user ID
+func (s *SQLiteStore) ListUsers(ctx context.Context) ([]models.User, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, *user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return users, nil
+}
+
+// SaveUser creates or updates an account, keeping its token
+func (s *SQLiteStore) SaveUser(ctx context.Context, user *models.User) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET username = excluded.username, name = excluded.name,
+		description = excluded.description, profile_image_url = excluded.profile_image_url,
+		location = excluded.location, url = excluded.url, verified = excluded.verified,
+		protected = excluded.protected, created_at = excluded.created_at,
+		followers_count = excluded.followers_count, following_count = excluded.following_count,
+		tweet_count = excluded.tweet_count, listed_count = excluded.listed_count, updated_at = excluded.updated_at`,
+		user.ID, user.Username, user.Name, user.Description, user.ProfileImageURL, user.Location, user.URL,
+		user.Verified, user.Protected, toUnix(user.CreatedAt), user.PublicMetrics.FollowersCount,
+		user.PublicMetrics.FollowingCount, user.PublicMetrics.TweetCount, user.PublicMetrics.ListedCount,
+		toUnix(user.UpdatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to save user: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUser removes an account and its token
+func (s *SQLiteStore) DeleteUser(ctx context.Context, id string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return nil
+}
+
+// LoadToken returns the token of an account
+func (s *SQLiteStore) LoadToken(ctx context.Context, userID string) (*models.Token, error) {
+	var (
+		token  models.Token
+		expiry int64
+		scopes string
+	)
+
+	err := s.db.QueryRowContext(ctx, `SELECT access_token, refresh_token, expiry, scopes FROM tokens WHERE user_id = ?`, userID).
+		Scan(&token.AccessToken, &token.RefreshToken, &expiry, &scopes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to load token: %w", err)
+	}
+
+	token.Expiry = fromUnix(expiry)
+	token.Scopes = strings.Fields(scopes)
+
+	return &token, nil
+}
+
+// SaveToken replaces the token of an account, the account must exist
+func (s *SQLiteStore) SaveToken(ctx context.Context, userID string, token *models.Token) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO tokens (user_id, access_token, refresh_token, expiry, scopes) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET access_token = excluded.access_token, refresh_token = excluded.refresh_token,
+		expiry = excluded.expiry, scopes = excluded.scopes`,
+		userID, token.AccessToken, token.RefreshToken, toUnix(token.Expiry), strings.Join(token.Scopes, " "))
+	if err != nil {
+		if isForeignKeyError(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to save token: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteToken removes the token of an account, keeping the account
+func (s *SQLiteStore) DeleteToken(ctx context.Context, userID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+
+	return nil
+}
+
+func isForeignKeyError(err error) bool {
+	var sqliteErr sqlite3.Error
+
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey
+}
+
+func isUniqueError(err error) bool {
+	var sqliteErr sqlite3.Error
+
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// toUnix converts t to a unix timestamp, the zero time is stored as 0
+func toUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+// fromUnix converts a unix timestamp stored by toUnix back to a time
+func fromUnix(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(sec, 0).UTC()
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"twitter-bookmarks/models"
+)
+
+// ErrNotFound is returned when the requested record does not exist
+var ErrNotFound = errors.New("not found")
+
+// UserStore is the registry of connected Twitter accounts, keyed by Twitter user ID
+type UserStore interface {
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	ListUsers(ctx context.Context) ([]models.User, error)
+	SaveUser(ctx context.Context, user *models.User) error
+	DeleteUser(ctx context.Context, id string) error
+}
+
+// TokenStore persists the OAuth2 token of each connected Twitter account
+type TokenStore interface {
+	LoadToken(ctx context.Context, userID string) (*models.Token, error)
+	SaveToken(ctx context.Context, userID string, token *models.Token) error
+	DeleteToken(ctx context.Context, userID string) error
+}
+
+// AccountStore stores the connected accounts along with their tokens
+type AccountStore interface {
+	UserStore
+	TokenStore
+}
+
+// BookmarkStore archives the bookmarks of each account
+type BookmarkStore interface {
+	// KnownBookmarks returns which of tweetIDs are archived and still bookmarked for an account
+	KnownBookmarks(ctx context.Context, userID string, tweetIDs []string) (map[string]bool, error)
+	// SaveBookmarks inserts new bookmarks and updates known ones, seenAt is when they were fetched.
+	// New and restored bookmarks are recorded as added in the history and rules are applied to them
+	// in the same transaction, it returns the bookmarks matched by each rule.
+	SaveBookmarks(ctx context.Context, userID string, bookmarks []models.Bookmark, rules []models.Rule, seenAt time.Time) ([]models.RuleMatches, error)
+	// RemoveBookmarks tombstones the bookmarks of an account missing from keep and records them as
+	// removed in the history, it returns how many bookmarks were removed
+	RemoveBookmarks(ctx context.Context, userID string, keep []string, removedAt time.Time) (int, error)
+	GetBookmark(ctx context.Context, userID, tweetID string) (*models.Bookmark, error)
+	// BookmarkHistory returns a page of the events of an account kept by filter, most recent first
+	BookmarkHistory(ctx context.Context, userID string, filter HistoryFilter) (*models.HistoryResponse, error)
+}
+
+// RuleStore stores the rules tagging and collecting the bookmarks of each account
+type RuleStore interface {
+	ListRules(ctx context.Context, userID string) ([]models.Rule, error)
+	// ApplyRules tags and collects the archived bookmarks tweetIDs of an account matched by each
+	// rule, nil tweetIDs apply the rules to every archived bookmark
+	ApplyRules(ctx context.Context, userID string, rules []models.Rule, tweetIDs []string, now time.Time) ([]models.RuleMatches, error)
+}
+
+// ThreadStore archives the threads of the bookmarked tweets
+type ThreadStore interface {
+	SaveThread(ctx context.Context, userID string, thread *models.Thread) error
+	// ThreadOf returns the archived thread holding a tweet
+	ThreadOf(ctx context.Context, userID, tweetID string) (*models.Thread, error)
+}
+
+// MediaStore records the media of the archived bookmarks mirrored to local files
+type MediaStore interface {
+	// ArchivedMedia returns the media attached to the archived bookmarks of every account and to the
+	// tweets they reference
+	ArchivedMedia(ctx context.Context) ([]models.Media, error)
+	// MediaFiles returns the mirrored files of urls, keyed by URL, urls never mirrored are missing
+	MediaFiles(ctx context.Context, urls []string) (map[string]models.MediaFile, error)
+	SaveMediaFile(ctx context.Context, file models.MediaFile) error
+	// MediaFileByHash returns a mirrored file holding the content with the given hash
+	MediaFileByHash(ctx context.Context, hash string) (*models.MediaFile, error)
+}
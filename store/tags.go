@@ -0,0 +1,204 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"twitter-bookmarks/models"
+)
+
+// ErrInvalidTag is returned when a tag is empty, too long or holds a comma
+var ErrInvalidTag = errors.New("invalid tag")
+
+// maxTagLength is the maximum number of characters of a tag
+const maxTagLength = 64
+
+// NormalizeTags trims and lower cases tags and drops duplicates
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength || strings.ContainsAny(tag, ",\x1f") {
+			return nil, fmt.Errorf("%w %q, tags must hold 1 to %d characters and no comma", ErrInvalidTag, tag, maxTagLength)
+		}
+
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+
+	return normalized, nil
+}
+
+// SetTags replaces the tags of an archived bookmark
+func (s *SQLiteStore) SetTags(ctx context.Context, userID, tweetID string, tags []string, now time.Time) error {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := bookmarkExists(ctx, tx, userID, tweetID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM bookmark_tags WHERE user_id = ? AND tweet_id = ?`, userID, tweetID); err != nil {
+		return fmt.Errorf("failed to delete tags: %w", err)
+	}
+
+	for _, tag := range tags {
+		_, err := tx.ExecContext(ctx, `INSERT INTO bookmark_tags (user_id, tweet_id, tag, created_at) VALUES (?, ?, ?, ?)`,
+			userID, tweetID, tag, toUnix(now))
+		if err != nil {
+			return fmt.Errorf("failed to save tag %s: %w", tag, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tags: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveTags removes tags from an archived bookmark, every tag is removed when tags is empty
+func (s *SQLiteStore) RemoveTags(ctx context.Context, userID, tweetID string, tags []string) error {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := bookmarkExists(ctx, tx, userID, tweetID); err != nil {
+		return err
+	}
+
+	query := `DELETE FROM bookmark_tags WHERE user_id = ? AND tweet_id = ?`
+	args := []any{userID, tweetID}
+	if len(tags) > 0 {
+		query += ` AND tag IN (` + placeholders(len(tags)) + `)`
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to delete tags: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tags: %w", err)
+	}
+
+	return nil
+}
+
+// ListTags returns the tags of an account with the number of bookmarks they label, most used first
+func (s *SQLiteStore) ListTags(ctx context.Context, userID string) ([]models.Tag, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT tag, count(*) FROM bookmark_tags WHERE user_id = ?
+		GROUP BY tag ORDER BY count(*) DESC, tag`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make([]models.Tag, 0)
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+
+	return tags, nil
+}
+
+// MergeTags replaces the tags from by the tag to on every bookmark of an account, which renames a
+// tag when to is not used yet. It returns how many bookmarks gained the tag to.
+func (s *SQLiteStore) MergeTags(ctx context.Context, userID string, from []string, to string) (int, error) {
+	from, err := NormalizeTags(from)
+	if err != nil {
+		return 0, err
+	}
+
+	target, err := NormalizeTags([]string{to})
+	if err != nil {
+		return 0, err
+	}
+	to = target[0]
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var relabeled int
+	for _, tag := range from {
+		if tag == to {
+			continue
+		}
+
+		result, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO bookmark_tags (user_id, tweet_id, tag, created_at)
+			SELECT user_id, tweet_id, ?, created_at FROM bookmark_tags WHERE user_id = ? AND tag = ?`, to, userID, tag)
+		if err != nil {
+			return 0, fmt.Errorf("failed to merge tag %s: %w", tag, err)
+		}
+
+		added, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to merge tag %s: %w", tag, err)
+		}
+		relabeled += int(added)
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM bookmark_tags WHERE user_id = ? AND tag = ?`, userID, tag); err != nil {
+			return 0, fmt.Errorf("failed to delete tag %s: %w", tag, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit tags: %w", err)
+	}
+
+	return relabeled, nil
+}
+
+// bookmarkExists returns ErrNotFound unless a bookmark is archived for an account
+func bookmarkExists(ctx context.Context, tx *sql.Tx, userID, tweetID string) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM bookmarks WHERE user_id = ? AND tweet_id = ?)`,
+		userID, tweetID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to get bookmark: %w", err)
+	}
+
+	if !exists {
+		return ErrNotFound
+	}
+
+	return nil
+}
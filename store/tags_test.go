@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"twitter-bookmarks/models"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{"none", nil, []string{}},
+		{"sorted", []string{"news", "go"}, []string{"go", "news"}},
+		{"trimmed", []string{"  go\t"}, []string{"go"}},
+		{"lower cased", []string{"GoLang", "ÉTÉ"}, []string{"golang", "été"}},
+		{"duplicates", []string{"go", "Go", " go "}, []string{"go"}},
+		{"spaces inside", []string{"to read"}, []string{"to read"}},
+		{"longest", []string{strings.Repeat("é", maxTagLength)}, []string{strings.Repeat("é", maxTagLength)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeTags(tt.tags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeTags(%q) = %q, want %q", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTagsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+	}{
+		{"empty", []string{"go", ""}},
+		{"blank", []string{"   "}},
+		{"too long", []string{strings.Repeat("a", maxTagLength+1)}},
+		{"comma", []string{"go,rust"}},
+		{"separator", []string{"go\x1frust"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NormalizeTags(tt.tags); !errors.Is(err, ErrInvalidTag) {
+				t.Errorf("NormalizeTags(%q) err = %v, want ErrInvalidTag", tt.tags, err)
+			}
+		})
+	}
+}
+
+// tagBookmarks archives the bookmarks 1 to 4 and tags them with tags
+func tagBookmarks(t *testing.T, s *SQLiteStore, tags map[string][]string) {
+	t.Helper()
+
+	saveBookmarks(t, s, testBookmark("1", "one"), testBookmark("2", "two"), testBookmark("3", "three"), testBookmark("4", "four"))
+	for tweetID, labels := range tags {
+		if err := s.SetTags(context.Background(), testUserID, tweetID, labels, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// bookmarkTags returns the sorted tags of an archived bookmark
+func bookmarkTags(t *testing.T, s *SQLiteStore, tweetID string) []string {
+	t.Helper()
+
+	bookmark, err := s.GetBookmark(context.Background(), testUserID, tweetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := append([]string{}, bookmark.Tags...)
+	sort.Strings(tags)
+
+	return tags
+}
+
+// listTags returns the tags of the test account
+func listTags(t *testing.T, s *SQLiteStore) []models.Tag {
+	t.Helper()
+
+	tags, err := s.ListTags(context.Background(), testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tags
+}
+
+func TestSetTagsUnknownBookmark(t *testing.T) {
+	s := newTestStore(t)
+
+	if err := s.SetTags(context.Background(), testUserID, "1", []string{"go"}, time.Now()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetTags() err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestListTagsAfterRemoval(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	tagBookmarks(t, s, map[string][]string{
+		"1": {"go", "news"},
+		"2": {"Go", "rust"},
+		"3": {"go", "news", "rust"},
+	})
+
+	want := []models.Tag{{Name: "go", Count: 3}, {Name: "news", Count: 2}, {Name: "rust", Count: 2}}
+	if got := listTags(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %+v, want %+v", got, want)
+	}
+
+	if err := s.RemoveTags(ctx, testUserID, "3", []string{"GO", "rust"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveTags(ctx, testUserID, "1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want = []models.Tag{{Name: "go", Count: 1}, {Name: "news", Count: 1}, {Name: "rust", Count: 1}}
+	if got := listTags(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("tags after removal = %+v, want %+v", got, want)
+	}
+	if got := bookmarkTags(t, s, "3"); !reflect.DeepEqual(got, []string{"news"}) {
+		t.Errorf("tags of 3 = %q, want [news]", got)
+	}
+
+	if err := s.RemoveTags(ctx, testUserID, "2", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveTags(ctx, testUserID, "3", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := listTags(t, s); len(got) != 0 {
+		t.Errorf("tags = %+v, want none", got)
+	}
+
+	if err := s.RemoveTags(ctx, testUserID, "5", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RemoveTags() err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMergeTagsRename(t *testing.T) {
+	s := newTestStore(t)
+	tagBookmarks(t, s, map[string][]string{
+		"1": {"golang", "news"},
+		"2": {"golang"},
+	})
+
+	relabeled, err := s.MergeTags(context.Background(), testUserID, []string{"GoLang"}, " Go ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relabeled != 2 {
+		t.Errorf("relabeled = %d, want 2", relabeled)
+	}
+
+	want := []models.Tag{{Name: "go", Count: 2}, {Name: "news", Count: 1}}
+	if got := listTags(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %+v, want %+v", got, want)
+	}
+	if got := bookmarkTags(t, s, "1"); !reflect.DeepEqual(got, []string{"go", "news"}) {
+		t.Errorf("tags of 1 = %q, want [go news]", got)
+	}
+}
+
+func TestMergeTagsExisting(t *testing.T) {
+	s := newTestStore(t)
+	tagBookmarks(t, s, map[string][]string{
+		"1": {"go", "golang"},
+		"2": {"golang", "gopher"},
+		"3": {"go"},
+		"4": {"gopher", "rust"},
+	})
+
+	// only the bookmarks 2 and 4 were not tagged go yet
+	relabeled, err := s.MergeTags(context.Background(), testUserID, []string{"golang", "gopher", "go"}, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relabeled != 2 {
+		t.Errorf("relabeled = %d, want 2", relabeled)
+	}
+
+	want := []models.Tag{{Name: "go", Count: 4}, {Name: "rust", Count: 1}}
+	if got := listTags(t, s); !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %+v, want %+v", got, want)
+	}
+
+	for tweetID, want := range map[string][]string{
+		"1": {"go"},
+		"2": {"go"},
+		"3": {"go"},
+		"4": {"go", "rust"},
+	} {
+		if got := bookmarkTags(t, s, tweetID); !reflect.DeepEqual(got, want) {
+			t.Errorf("tags of %s = %q, want %q", tweetID, got, want)
+		}
+	}
+}
+
+func TestListBookmarksTagged(t *testing.T) {
+	s := newTestStore(t)
+	tagBookmarks(t, s, map[string][]string{
+		"1": {"go", "news"},
+		"2": {"go"},
+		"3": {"news", "rust"},
+	})
+
+	tests := []struct {
+		name   string
+		filter BookmarkFilter
+		want   []string
+	}{
+		{"one tag", BookmarkFilter{Tags: []string{"go"}}, []string{"1", "2"}},
+		{"all tags", BookmarkFilter{Tags: []string{"go", "news"}}, []string{"1"}},
+		{"any tag", BookmarkFilter{Tags: []string{"go", "news"}, AnyTag: true}, []string{"1", "2", "3"}},
+		{"all tags without match", BookmarkFilter{Tags: []string{"go", "rust"}}, []string{}},
+		{"any tag with unknown", BookmarkFilter{Tags: []string{"rust", "java"}, AnyTag: true}, []string{"3"}},
+		{"unknown tag", BookmarkFilter{Tags: []string{"java"}}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Limit = 10
+			if got := listIDs(t, s, tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bookmarks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"twitter-bookmarks/models"
+)
+
+// ErrThreadNotFound is returned when no archived thread holds a tweet
+var ErrThreadNotFound = fmt.Errorf("thread %w", ErrNotFound)
+
+// SaveThread creates or replaces the archived thread of an author in a conversation, ExpandedAt is
+// truncated to the precision of the archive
+func (s *SQLiteStore) SaveThread(ctx context.Context, userID string, thread *models.Thread) error {
+	tweets, err := json.Marshal(thread.Tweets)
+	if err != nil {
+		return fmt.Errorf("failed to encode thread: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO threads (user_id, conversation_id, author_id, tweets, expanded_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, conversation_id, author_id) DO UPDATE SET tweets = excluded.tweets, expanded_at = excluded.expanded_at`,
+		userID, thread.ConversationID, thread.AuthorID, tweets, toUnix(thread.ExpandedAt))
+	if err != nil {
+		return fmt.Errorf("failed to save thread: %w", err)
+	}
+	thread.ExpandedAt = fromUnix(toUnix(thread.ExpandedAt))
+
+	return nil
+}
+
+// ThreadOf returns the archived thread holding a tweet, the most recently expanded one when the
+// tweet belongs to several
+func (s *SQLiteStore) ThreadOf(ctx context.Context, userID, tweetID string) (*models.Thread, error) {
+	var (
+		thread     models.Thread
+		tweets     []byte
+		expandedAt int64
+	)
+
+	err := s.db.QueryRowContext(ctx, `SELECT t.conversation_id, t.author_id, t.tweets, t.expanded_at
+		FROM threads t, json_each(t.tweets) tweet
+		WHERE t.user_id = ? AND json_extract(tweet.value, '$.id') = ?
+		ORDER BY t.expanded_at DESC LIMIT 1`, userID, tweetID).Scan(&thread.ConversationID, &thread.AuthorID, &tweets, &expandedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrThreadNotFound
+		}
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+
+	if err := json.Unmarshal(tweets, &thread.Tweets); err != nil {
+		return nil, fmt.Errorf("failed to decode thread: %w", err)
+	}
+	thread.ExpandedAt = fromUnix(expandedAt)
+
+	return &thread, nil
+}